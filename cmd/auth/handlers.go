@@ -21,14 +21,14 @@ const (
 )
 
 type loginForm struct {
-	Email    string `form:"email"`
-	Password string `form:"password"`
+	Email    string `form:"email" json:"email"`
+	Password string `form:"password" json:"password"`
 }
 
 func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
 	var lgnForm loginForm
-	if err := helpers.ParseForm(r, &lgnForm); err != nil {
-		app.serverError(w, r, err)
+	if err := helpers.DecodeRequest(w, r, &lgnForm); err != nil {
+		app.decodeError(w, r, err)
 		return
 	}
 
@@ -90,14 +90,14 @@ func (app *application) loginHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 type SignUpForm struct {
-	Email    string `form:"email"`
-	Password string `form:"password"`
+	Email    string `form:"email" json:"email"`
+	Password string `form:"password" json:"password"`
 }
 
 func (app *application) signUpHandler(w http.ResponseWriter, r *http.Request) {
 	var signUpForm SignUpForm
-	if err := helpers.ParseForm(r, &signUpForm); err != nil {
-		app.badRequest(w, r, err)
+	if err := helpers.DecodeRequest(w, r, &signUpForm); err != nil {
+		app.decodeError(w, r, err)
 		return
 	}
 	if !Matches(signUpForm.Email, EmailRX) || Blank(signUpForm.Password) || !MinChars(signUpForm.Password, 8) {
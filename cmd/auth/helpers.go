@@ -1,6 +1,10 @@
 package main
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+	"shortening-api/internal/helpers"
+)
 
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
@@ -21,3 +25,17 @@ func (app *application) clientError(w http.ResponseWriter, r *http.Request, err
 	app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
 	http.Error(w, http.StatusText(status), status)
 }
+
+// decodeError answers a request whose body could not be decoded
+func (app *application) decodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, helpers.ErrUnsupportedMediaType) {
+		app.clientError(w, r, err, http.StatusUnsupportedMediaType)
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, helpers.ErrBodyTooLarge) || errors.As(err, &maxBytesErr) {
+		app.clientError(w, r, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	app.clientError(w, r, err, http.StatusBadRequest)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/go-chi/chi/v5"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -38,12 +39,30 @@ func (app *application) proxyHandler(serviceBaseURL string) http.Handler {
 			req.URL.Host = targetURL.Host
 			req.URL.Path = singleJoiningSlash(targetURL.Path, suffix)
 			req.URL.RawPath = ""
+			// the redirect service picks the short domain by the host visitors asked for
+			req.Header.Set("X-Forwarded-Host", req.Host)
 			req.Host = targetURL.Host
+			// only the gateway says who is calling, whatever the client sent
+			req.Header.Del("X-User-ID")
+			req.Header.Del(helpers.AnonymousSessionHeader)
+			if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+				req.Header.Set("X-Real-IP", host)
+			}
 			ctx := req.Context()
 			if userID, ok := ctx.Value(helpers.UserIDKey).(string); ok {
 				app.logger.Debug("forwarding user ID into http headers")
 				req.Header.Set("X-User-ID", userID)
 			}
+			// signed in users pass their old session on to claim its links
+			session, ok := ctx.Value(helpers.AnonymousSessionKey).(string)
+			if !ok {
+				if cookie, err := req.Cookie(helpers.AnonymousSessionCookie); err == nil {
+					session = cookie.Value
+				}
+			}
+			if session != "" {
+				req.Header.Set(helpers.AnonymousSessionHeader, session)
+			}
 			app.logger.Debug("Proxied URL path: " + req.URL.Path)
 		},
 	}
@@ -13,6 +13,8 @@ import (
 type application struct {
 	logger  *slog.Logger
 	queries *database.Queries
+	// anonymous lets visitors without an account shorten links
+	anonymous bool
 }
 
 func main() {
@@ -37,6 +39,11 @@ func main() {
 		log.Fatal(err)
 	}
 
+	anonymous, err := helpers.GetEnvBool("ANONYMOUS_SHORTENING", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource: true,
 		Level:     slog.LevelDebug,
@@ -45,8 +52,9 @@ func main() {
 	queries := database.New(db)
 
 	app := application{
-		logger:  logger,
-		queries: queries,
+		logger:    logger,
+		queries:   queries,
+		anonymous: anonymous,
 	}
 	r := chi.NewRouter()
 	r.Use(app.logRequest, app.recoverPanic)
@@ -54,7 +62,7 @@ func main() {
 		r.Mount("/auth", app.proxyHandler("http://localhost:"+authPort))
 		// use auth middleware
 		r.Route("/shorten", func(r chi.Router) {
-			r.Use(app.authMiddleware)
+			r.Use(app.shortenAuthMiddleware)
 			r.Handle("/*", app.proxyHandler("http://localhost:"+shortenerPort))
 		})
 		r.Route("/redirect", func(r chi.Router) {
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
@@ -12,8 +14,14 @@ import (
 	"log"
 	"net/http"
 	"shortening-api/internal/helpers"
+	"strings"
+	"time"
 )
 
+// AnonymousSessionTTL is how long a browser can claim the links it shortened
+// without an account
+const AnonymousSessionTTL = 30 * 24 * time.Hour
+
 func (app *application) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		gatewayPort, err := helpers.GetEnv("GATEWAY_PORT")
@@ -73,6 +81,46 @@ func (app *application) authMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// shortenAuthMiddleware lets requests without a token shorten a single link
+// when anonymous shortening is on. They are tied to a browser session cookie,
+// which is created here and lets the links be claimed after signing up.
+// Everything else needs a token.
+func (app *application) shortenAuthMiddleware(next http.Handler) http.Handler {
+	authenticated := app.authMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimSuffix(r.URL.Path, "/")
+		if !app.anonymous || r.Header.Get("Authorization") != "" || r.Method != http.MethodPost || path != "/api/shorten" {
+			authenticated.ServeHTTP(w, r)
+			return
+		}
+
+		session := ""
+		if cookie, err := r.Cookie(helpers.AnonymousSessionCookie); err == nil && cookie.Value != "" {
+			session = cookie.Value
+		} else {
+			b := make([]byte, 32)
+			if _, err := rand.Read(b); err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			session = base64.RawURLEncoding.EncodeToString(b)
+			http.SetCookie(w, &http.Cookie{
+				Name:     helpers.AnonymousSessionCookie,
+				Value:    session,
+				Path:     "/api/shorten",
+				MaxAge:   int(AnonymousSessionTTL.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		app.logger.Debug("anonymous shortening request")
+		ctx := context.WithValue(r.Context(), helpers.AnonymousSessionKey, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) logRequest(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"shortening-api/internal/geo"
+	"shortening-api/internal/helpers"
+	"shortening-api/internal/variants"
+	"strings"
+	"time"
+)
+
+// cachedLink is what the redirect service keeps in redis for every hash. It
+// carries enough metadata to decide whether the cached destination can be
+// served straight away.
+type cachedLink struct {
+	Destination string `json:"destination"`
+	// IOS and Android replace Destination for visitors on those platforms
+	IOS     string `json:"ios,omitempty"`
+	Android string `json:"android,omitempty"`
+	// Geo sends visitors from some countries elsewhere
+	Geo []geo.Rule `json:"geo,omitempty"`
+	// Variants replace Destination for everyone else, split by weight
+	Variants  []variants.Variant `json:"variants,omitempty"`
+	Protected bool               `json:"protected,omitempty"`
+	// Limited links count every visit in postgres, so the cached destination is
+	// only served after a visit was consumed there
+	Limited bool `json:"limited,omitempty"`
+	// Inactive entries stand for a link outside of its schedule. They are
+	// cached until the next schedule boundary at the latest, just like active
+	// ones, so redis never serves a link on the wrong side of one.
+	Inactive bool       `json:"inactive,omitempty"`
+	Fallback string     `json:"fallback,omitempty"`
+	OpensAt  *time.Time `json:"opens_at,omitempty"`
+}
+
+// targetFor picks the destination for a visitor on device from country, if
+// any of the link's targets applies. Device links come first, they usually lead
+// to an app store that works anywhere, then the country rules.
+func (entry cachedLink) targetFor(device, country string) (string, bool) {
+	switch {
+	case device == DeviceIOS && entry.IOS != "":
+		return entry.IOS, true
+	case device == DeviceAndroid && entry.Android != "":
+		return entry.Android, true
+	}
+	return geo.Match(entry.Geo, country)
+}
+
+// deviceTargeted reports whether visitors on different devices can end up in
+// different places
+func (entry cachedLink) deviceTargeted() bool {
+	return entry.IOS != "" || entry.Android != ""
+}
+
+// getCachedLink reports a miss for anything it can't decode, including entries
+// written before links were cached as records, so those fall back to the db.
+func (app *application) getCachedLink(ctx context.Context, ref linkRef) (cachedLink, bool) {
+	value, err := app.cache.Get(ctx, ref.cacheKey()).Bytes()
+	if err != nil {
+		return cachedLink{}, false
+	}
+	var entry cachedLink
+	if err := json.Unmarshal(value, &entry); err != nil || entry.Destination == "" {
+		return cachedLink{}, false
+	}
+	return entry, true
+}
+
+func (app *application) cacheLink(ctx context.Context, ref linkRef, entry cachedLink, ttl time.Duration) {
+	if ttl < time.Millisecond {
+		// redis would keep the entry forever, and it's about to change anyway
+		return
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		app.logger.Error("failed to encode cached link", "hash", ref.hash, "err", err)
+		return
+	}
+	_, err = app.cache.Set(ctx, ref.cacheKey(), value, ttl).Result()
+	if err != nil {
+		app.logger.Error("redis failed to cache the link redirect request")
+	}
+}
+
+func (app *application) evictLink(ctx context.Context, key string) {
+	if err := app.cache.Del(ctx, key).Err(); err != nil {
+		app.logger.Error("redis failed to evict cached entry", "key", key, "err", err)
+	}
+}
+
+// listenForInvalidations drops cached links and domains that another service
+// changed. With a shared redis the entry is gone already, this covers replicas
+// that cache in a redis of their own.
+func (app *application) listenForInvalidations(ctx context.Context) {
+	sub := app.cache.Subscribe(ctx, helpers.LinkInvalidationChannel)
+	defer sub.Close()
+
+	for msg := range sub.Channel() {
+		app.logger.Debug("invalidating cached entry", "key", msg.Payload)
+		app.evictLink(ctx, msg.Payload)
+		if hostname, ok := strings.CutPrefix(msg.Payload, helpers.DomainCacheKey("")); ok {
+			app.unknownHosts.remove(hostname)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+	// DeviceOther is desktops and every platform without a destination of its own
+	DeviceOther = ""
+)
+
+// deviceOf tells the platforms with their own destinations apart by the
+// User-Agent. Anything unrecognised gets the default destination.
+func deviceOf(r *http.Request) string {
+	ua := r.UserAgent()
+	switch {
+	// Windows Phone claims to be both Android and an iPhone
+	case strings.Contains(ua, "Windows Phone"):
+		return DeviceOther
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "iPod"):
+		return DeviceIOS
+	case strings.Contains(ua, "Android"):
+		return DeviceAndroid
+	}
+	return DeviceOther
+}
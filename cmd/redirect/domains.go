@@ -0,0 +1,157 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net"
+	"net/http"
+	"shortening-api/internal/helpers"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DomainCacheTTL bounds how long a hostname lookup is cached. Verifying
+	// and deleting domains invalidates it right away.
+	DomainCacheTTL = 10 * time.Minute
+	// MaxUnknownHosts bounds how many hostnames that aren't a verified custom
+	// domain are remembered. Any client can send a made up Host, so they are
+	// kept in memory instead of redis.
+	MaxUnknownHosts = 1024
+)
+
+// linkRef is a short code on the short domain a request came in on
+type linkRef struct {
+	// domainID is invalid for the default short domain
+	domainID pgtype.UUID
+	hostname string
+	hash     string
+}
+
+// cacheKey is where the redirect of the link is cached
+func (ref linkRef) cacheKey() string {
+	return helpers.LinkCacheKey(ref.domainID, ref.hash)
+}
+
+// linkRefOf resolves which link a request for urlHash means. Requests on any
+// host that isn't a verified custom domain go to the default short domain.
+func (app *application) linkRefOf(r *http.Request, urlHash string) (linkRef, error) {
+	hostname := requestHostname(r)
+	domainID, err := app.domainOf(r.Context(), hostname)
+	if err != nil {
+		return linkRef{}, err
+	}
+	ref := linkRef{domainID: domainID, hash: urlHash}
+	if domainID.Valid {
+		ref.hostname = hostname
+	}
+	return ref, nil
+}
+
+// domainOf looks up the verified custom domain called hostname, going to the
+// db only when neither redis nor unknownHosts know the hostname yet.
+func (app *application) domainOf(ctx context.Context, hostname string) (pgtype.UUID, error) {
+	if hostname == "" || app.unknownHosts.contains(hostname, time.Now()) {
+		return pgtype.UUID{}, nil
+	}
+	key := helpers.DomainCacheKey(hostname)
+	if cached, err := app.cache.Get(ctx, key).Result(); err == nil {
+		if id, err := uuid.Parse(cached); err == nil {
+			return pgtype.UUID{Bytes: id, Valid: true}, nil
+		}
+	}
+
+	domain, err := app.queries.GetVerifiedDomain(ctx, hostname)
+	if errors.Is(err, sql.ErrNoRows) {
+		app.unknownHosts.add(hostname, time.Now())
+		return pgtype.UUID{}, nil
+	}
+	if err != nil {
+		return pgtype.UUID{}, err
+	}
+	if err := app.cache.Set(ctx, key, domain.ID.String(), DomainCacheTTL).Err(); err != nil {
+		app.logger.Error("redis failed to cache the domain", "hostname", hostname, "err", err)
+	}
+	return pgtype.UUID{Bytes: domain.ID, Valid: true}, nil
+}
+
+// hostSet remembers up to max hostnames for ttl each. When it's full the least
+// recently used hostname makes room.
+type hostSet struct {
+	mu  sync.Mutex
+	max int
+	ttl time.Duration
+	// order has the most recently used hostname in front
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type hostEntry struct {
+	hostname string
+	expires  time.Time
+}
+
+func newHostSet(max int, ttl time.Duration) *hostSet {
+	return &hostSet{max: max, ttl: ttl, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (s *hostSet) contains(hostname string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, ok := s.entries[hostname]
+	if !ok {
+		return false
+	}
+	if !now.Before(elem.Value.(*hostEntry).expires) {
+		s.order.Remove(elem)
+		delete(s.entries, hostname)
+		return false
+	}
+	s.order.MoveToFront(elem)
+	return true
+}
+
+func (s *hostSet) add(hostname string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[hostname]; ok {
+		elem.Value.(*hostEntry).expires = now.Add(s.ttl)
+		s.order.MoveToFront(elem)
+		return
+	}
+	for s.order.Len() >= s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*hostEntry).hostname)
+	}
+	s.entries[hostname] = s.order.PushFront(&hostEntry{hostname: hostname, expires: now.Add(s.ttl)})
+}
+
+func (s *hostSet) remove(hostname string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[hostname]; ok {
+		s.order.Remove(elem)
+		delete(s.entries, hostname)
+	}
+}
+
+// requestHostname is the host the visitor asked for. The gateway passes it on
+// in X-Forwarded-Host since it rewrites the Host header.
+func requestHostname(r *http.Request) string {
+	host := r.Header.Get("X-Forwarded-Host")
+	if host == "" {
+		host = r.Host
+	}
+	host, _, _ = strings.Cut(host, ",")
+	host = strings.TrimSpace(host)
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestHostSetIsBounded(t *testing.T) {
+	now := time.Now()
+	s := newHostSet(3, time.Minute)
+	for i := 0; i < 100; i++ {
+		s.add("host"+strconv.Itoa(i)+".test", now)
+	}
+	if len(s.entries) != 3 || s.order.Len() != 3 {
+		t.Fatalf("set holds %d hostnames, want 3", len(s.entries))
+	}
+	if s.contains("host0.test", now) {
+		t.Error("the oldest hostname was kept")
+	}
+	if !s.contains("host99.test", now) {
+		t.Error("the newest hostname was dropped")
+	}
+}
+
+func TestHostSetKeepsRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	s := newHostSet(2, time.Minute)
+	s.add("a.test", now)
+	s.add("b.test", now)
+	s.contains("a.test", now)
+	s.add("c.test", now)
+	if !s.contains("a.test", now) || s.contains("b.test", now) {
+		t.Error("the least recently used hostname didn't make room")
+	}
+}
+
+func TestHostSetExpires(t *testing.T) {
+	now := time.Now()
+	s := newHostSet(2, time.Minute)
+	s.add("a.test", now)
+	if !s.contains("a.test", now.Add(59*time.Second)) {
+		t.Error("hostname expired early")
+	}
+	if s.contains("a.test", now.Add(time.Minute)) {
+		t.Error("hostname outlived its ttl")
+	}
+
+	s.add("b.test", now)
+	s.remove("b.test")
+	if s.contains("b.test", now) {
+		t.Error("removed hostname is still known")
+	}
+}
@@ -4,11 +4,19 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"net"
 	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/geo"
+	"shortening-api/internal/helpers"
+	"shortening-api/internal/variants"
 	"strings"
 	"time"
 )
 
+const CacheTTL = time.Hour * 24 * 3
+
 func (app *application) redirectHandler(w http.ResponseWriter, r *http.Request) {
 	urlHash := strings.TrimPrefix(r.URL.Path, "/")
 	if urlHash == "" {
@@ -16,13 +24,21 @@ func (app *application) redirectHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	link, err := app.cache.Get(r.Context(), urlHash).Result()
-	if err == nil {
-		http.Redirect(w, r, link, http.StatusFound)
+	ref, err := app.linkRefOf(r, urlHash)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	dbLink, err := app.queries.GetLink(r.Context(), urlHash)
+	if entry, ok := app.getCachedLink(r.Context(), ref); ok {
+		app.serveLink(w, r, ref, entry)
+		return
+	}
+
+	dbLink, err := app.queries.GetDomainLink(r.Context(), database.GetDomainLinkParams{
+		Hash:     urlHash,
+		DomainID: ref.domainID,
+	})
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			app.clientError(w, r, err, http.StatusNotFound)
@@ -31,10 +47,234 @@ func (app *application) redirectHandler(w http.ResponseWriter, r *http.Request)
 		app.serverError(w, r, err)
 		return
 	}
-	_, err = app.cache.Set(r.Context(), urlHash, dbLink.Link.String, time.Hour*24*3).Result()
+	if dbLink.DeletedAt.Valid {
+		app.clientError(w, r, fmt.Errorf("link %s is deleted", urlHash), http.StatusNotFound)
+		return
+	}
+	now := time.Now()
+	if expired(dbLink, now) {
+		app.clientError(w, r, fmt.Errorf("link %s expired", urlHash), http.StatusGone)
+		return
+	}
+
+	if dbLink.MaxVisits.Valid && dbLink.VisitCount >= dbLink.MaxVisits.Int32 {
+		app.clientError(w, r, fmt.Errorf("link %s reached its visit limit", urlHash), http.StatusGone)
+		return
+	}
+
+	entry, ttl, err := newCachedLink(dbLink, now)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.cacheLink(r.Context(), ref, entry, ttl)
+
+	app.serveLink(w, r, ref, entry)
+}
+
+// serveLink redirects to the destination, unless the link is outside of its
+// schedule or password protected and the visitor hasn't unlocked it yet.
+func (app *application) serveLink(w http.ResponseWriter, r *http.Request, ref linkRef, entry cachedLink) {
+	if entry.Inactive {
+		app.serveInactive(w, r, entry)
+		return
+	}
+	if entry.Protected && !app.hasUnlockCookie(r, ref) {
+		app.renderUnlockForm(w, r, http.StatusOK, "")
+		return
+	}
+	if entry.Limited && !app.consumeVisit(w, r, ref) {
+		return
+	}
+	app.redirect(w, r, ref, entry, http.StatusFound)
+}
+
+// consumeVisit counts a visit of a visit limited link. The conditional update
+// in postgres makes sure concurrent visitors can't go over the limit. It
+// answers the request itself and returns false when the visit was refused.
+func (app *application) consumeVisit(w http.ResponseWriter, r *http.Request, ref linkRef) bool {
+	_, err := app.queries.ConsumeLinkVisit(r.Context(), database.ConsumeLinkVisitParams{
+		Hash:     ref.hash,
+		DomainID: ref.domainID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.evictLink(r.Context(), ref.cacheKey())
+			app.clientError(w, r, fmt.Errorf("link %s reached its visit limit", ref.hash), http.StatusGone)
+			return false
+		}
+		app.serverError(w, r, err)
+		return false
+	}
+	return true
+}
+
+type unlockForm struct {
+	Password string `form:"password"`
+}
+
+func (app *application) unlockHandler(w http.ResponseWriter, r *http.Request) {
+	urlHash := strings.TrimPrefix(r.URL.Path, "/")
+	if urlHash == "" {
+		app.clientError(w, r, fmt.Errorf("empty link"), http.StatusBadRequest)
+		return
+	}
+
+	var form unlockForm
+	if err := helpers.ParseForm(r, &form); err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	ref, err := app.linkRefOf(r, urlHash)
 	if err != nil {
-		app.logger.Error("redis failed to cache the link redirect request")
+		app.serverError(w, r, err)
+		return
 	}
+	dbLink, ok := app.liveLink(w, r, ref)
+	if !ok {
+		return
+	}
+	entry, _, err := newCachedLink(dbLink, time.Now())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if entry.Inactive {
+		app.serveInactive(w, r, entry)
+		return
+	}
+
+	if dbLink.PasswordHash.Valid {
+		err := bcrypt.CompareHashAndPassword([]byte(dbLink.PasswordHash.String), []byte(form.Password))
+		if err != nil {
+			app.logger.Info("wrong password for protected link", "hash", urlHash)
+			app.renderUnlockForm(w, r, http.StatusUnauthorized, "Incorrect password")
+			return
+		}
+		app.setUnlockCookie(w, ref)
+	}
+	if dbLink.MaxVisits.Valid && !app.consumeVisit(w, r, ref) {
+		return
+	}
+
+	app.redirect(w, r, ref, entry, http.StatusSeeOther)
+}
+
+// redirect sends the visitor to the destination for their device and country,
+// or to their variant of a split link. Caches between us and them are told the
+// answer depends on the User-Agent, and that answers depending on the
+// visitor's address or cookies are theirs alone.
+func (app *application) redirect(w http.ResponseWriter, r *http.Request, ref linkRef, entry cachedLink, status int) {
+	if entry.deviceTargeted() {
+		w.Header().Add("Vary", "User-Agent")
+	}
+	country := ""
+	if len(entry.Geo) > 0 {
+		w.Header().Set("Cache-Control", "private")
+		country = app.visitorCountry(r)
+	}
+	destination, ok := entry.targetFor(deviceOf(r), country)
+	if !ok {
+		destination = entry.Destination
+		if len(entry.Variants) > 0 {
+			w.Header().Set("Cache-Control", "private")
+			destination = app.serveVariant(w, r, ref, entry.Variants).Link
+		}
+	}
+	http.Redirect(w, r, destination, status)
+}
+
+// visitorCountry looks the visitor up in the GeoIP database. Lookups that fail
+// give no country, so the visitor gets the default destination.
+func (app *application) visitorCountry(r *http.Request) string {
+	if app.geo == nil {
+		return ""
+	}
+	ip := app.clientIP(r)
+	if !ip.IsValid() {
+		return ""
+	}
+	country, err := app.geo.Country(net.IP(ip.AsSlice()))
+	if err != nil {
+		app.logger.Error("geoip lookup failed", "ip", ip.String(), "err", err)
+		return ""
+	}
+	return country
+}
+
+// liveLink loads a link that is neither deleted nor expired. It answers the
+// request itself and returns false otherwise.
+func (app *application) liveLink(w http.ResponseWriter, r *http.Request, ref linkRef) (database.Link, bool) {
+	urlHash := ref.hash
+	dbLink, err := app.queries.GetDomainLink(r.Context(), database.GetDomainLinkParams{
+		Hash:     urlHash,
+		DomainID: ref.domainID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return database.Link{}, false
+		}
+		app.serverError(w, r, err)
+		return database.Link{}, false
+	}
+	if dbLink.DeletedAt.Valid {
+		app.clientError(w, r, fmt.Errorf("link %s is deleted", urlHash), http.StatusNotFound)
+		return database.Link{}, false
+	}
+	if expired(dbLink, time.Now()) {
+		app.clientError(w, r, fmt.Errorf("link %s expired", urlHash), http.StatusGone)
+		return database.Link{}, false
+	}
+	return dbLink, true
+}
+
+// newCachedLink describes dbLink as seen at now and how long that description
+// holds. It never outlives the link's expiry or its next schedule boundary.
+func newCachedLink(dbLink database.Link, now time.Time) (cachedLink, time.Duration, error) {
+	window, err := linkWindow(dbLink)
+	if err != nil {
+		return cachedLink{}, 0, err
+	}
+
+	geoTargets, err := geo.DecodeRules(dbLink.GeoTargets)
+	if err != nil {
+		return cachedLink{}, 0, err
+	}
+	linkVariants, err := variants.Decode(dbLink.Variants)
+	if err != nil {
+		return cachedLink{}, 0, err
+	}
+
+	entry := cachedLink{
+		Destination: dbLink.Link.String,
+		IOS:         dbLink.IosLink.String,
+		Android:     dbLink.AndroidLink.String,
+		Geo:         geoTargets,
+		Variants:    linkVariants,
+		Protected:   dbLink.PasswordHash.Valid,
+		Limited:     dbLink.MaxVisits.Valid,
+	}
+	if !window.Active(now) {
+		entry.Inactive = true
+		entry.Fallback = dbLink.FallbackUrl.String
+		if opensAt := window.NextOpening(now); !opensAt.IsZero() {
+			entry.OpensAt = &opensAt
+		}
+	}
+
+	ttl := CacheTTL
+	if dbLink.ExpiresAt.Valid {
+		// the cached entry must never outlive the link itself
+		ttl = min(ttl, dbLink.ExpiresAt.Time.Sub(now))
+	}
+	if next := window.NextChange(now); !next.IsZero() {
+		ttl = min(ttl, next.Sub(now))
+	}
+	return entry, ttl, nil
+}
 
-	http.Redirect(w, r, dbLink.Link.String, http.StatusFound)
+func expired(dbLink database.Link, now time.Time) bool {
+	return dbLink.ExpiresAt.Valid && !dbLink.ExpiresAt.Time.After(now)
 }
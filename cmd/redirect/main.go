@@ -1,19 +1,41 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"github.com/redis/go-redis/v9"
 	"log"
 	"log/slog"
 	"net/http"
+	"net/netip"
 	"os"
 	"shortening-api/internal/database"
+	"shortening-api/internal/geo"
 	"shortening-api/internal/helpers"
+	"strings"
+	"time"
 )
 
+// GeoIPReloadInterval is how often the GeoIP database file is checked for changes
+const GeoIPReloadInterval = time.Minute
+
 type application struct {
 	logger  *slog.Logger
 	queries *database.Queries
 	cache   *redis.Client
+	// unlockSecret signs the cookies handed out for password protected links
+	unlockSecret []byte
+	// baseURL is the public prefix of short links, ending in a slash. QR codes
+	// of links on the default domain need it, behind the gateway the request
+	// host is the upstream one.
+	baseURL string
+	// geo finds the country of visitors for links with country rules, nil
+	// without a GEOIP_DATABASE
+	geo *geo.DB
+	// trustedProxies may tell the visitor's address in X-Forwarded-For
+	trustedProxies []netip.Prefix
+	// unknownHosts are recent hostnames that aren't a verified custom domain
+	unknownHosts *hostSet
 }
 
 func main() {
@@ -26,6 +48,33 @@ func main() {
 		log.Fatal(err)
 	}
 
+	unlockSecret, err := helpers.GetEnv("UNLOCK_COOKIE_SECRET")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	baseURL, err := helpers.GetEnv("SHORT_LINK_BASE_URL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if baseURL != "" && !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
+	trustedProxies, err := helpers.GetEnv("TRUSTED_PROXIES")
+	if err != nil {
+		log.Fatal(err)
+	}
+	proxies, err := parseTrustedProxies(trustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	geoIPDatabase, err := helpers.GetEnv("GEOIP_DATABASE")
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource: true,
 		Level:     slog.LevelDebug,
@@ -33,19 +82,45 @@ func main() {
 
 	queries := database.New(db)
 
-	client := redis.NewClient(&redis.Options{
-		Addr:     "localhost:6379",
-		Password: "",
-		DB:       0,
-		Protocol: 2,
-	})
+	client, err := helpers.OpenCache()
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	app := application{
-		logger:  logger,
-		queries: queries,
-		cache:   client,
+		logger:         logger,
+		queries:        queries,
+		cache:          client,
+		unlockSecret:   []byte(unlockSecret),
+		baseURL:        baseURL,
+		trustedProxies: proxies,
+		unknownHosts:   newHostSet(MaxUnknownHosts, DomainCacheTTL),
+	}
+	if len(app.unlockSecret) == 0 {
+		app.logger.Warn("UNLOCK_COOKIE_SECRET is not set, using a random secret; unlocked links won't carry over restarts or replicas")
+		app.unlockSecret = make([]byte, 32)
+		if _, err := rand.Read(app.unlockSecret); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if app.baseURL == "" {
+		app.logger.Warn("SHORT_LINK_BASE_URL is not set, QR codes of links on the default short domain answer 503")
 	}
 
+	if geoIPDatabase != "" {
+		app.geo, err = geo.Open(geoIPDatabase)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go app.geo.Watch(context.Background(), GeoIPReloadInterval, app.logger)
+	} else {
+		app.logger.Warn("GEOIP_DATABASE is not set, links with country rules always use their default destination")
+	}
+
+	go app.listenForInvalidations(context.Background())
+	go app.flushVariantStats(context.Background())
+
 	log.Println("redirect service is listening on port: " + port)
 	log.Fatal(http.ListenAndServe(":"+port, app.routes()))
 }
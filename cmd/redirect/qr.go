@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	QRDefaultSize  = 256
+	QRMinSize      = 64
+	QRMaxSize      = 2048
+	QRDefaultQuiet = 4
+	QRMaxQuiet     = 16
+	// QRCacheControl lets clients and CDNs keep a code for a day, the ETag
+	// makes revalidating it cheap
+	QRCacheControl = "public, max-age=86400"
+)
+
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrOptions are the rendering choices of GET /{hash}/qr
+type qrOptions struct {
+	format string
+	size   int
+	ecc    string
+	fg, bg color.NRGBA
+	quiet  int
+}
+
+func parseQROptions(query url.Values) (qrOptions, error) {
+	opts := qrOptions{
+		format: "png",
+		size:   QRDefaultSize,
+		ecc:    "M",
+		fg:     color.NRGBA{0, 0, 0, 0xff},
+		bg:     color.NRGBA{0xff, 0xff, 0xff, 0xff},
+		quiet:  QRDefaultQuiet,
+	}
+
+	if format := strings.ToLower(query.Get("format")); format != "" {
+		if format != "png" && format != "svg" {
+			return opts, fmt.Errorf("format must be png or svg")
+		}
+		opts.format = format
+	}
+	if size := query.Get("size"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < QRMinSize || n > QRMaxSize {
+			return opts, fmt.Errorf("size must be between %d and %d", QRMinSize, QRMaxSize)
+		}
+		opts.size = n
+	}
+	if ecc := strings.ToUpper(query.Get("ecc")); ecc != "" {
+		if _, ok := qrLevels[ecc]; !ok {
+			return opts, fmt.Errorf("ecc must be one of L, M, Q or H")
+		}
+		opts.ecc = ecc
+	}
+	if quiet := query.Get("quiet"); quiet != "" {
+		n, err := strconv.Atoi(quiet)
+		if err != nil || n < 0 || n > QRMaxQuiet {
+			return opts, fmt.Errorf("quiet must be between 0 and %d", QRMaxQuiet)
+		}
+		opts.quiet = n
+	}
+
+	var err error
+	if fg := query.Get("fg"); fg != "" {
+		if opts.fg, err = parseHexColor(fg); err != nil {
+			return opts, fmt.Errorf("fg: %w", err)
+		}
+	}
+	if bg := query.Get("bg"); bg != "" {
+		if opts.bg, err = parseHexColor(bg); err != nil {
+			return opts, fmt.Errorf("bg: %w", err)
+		}
+	}
+	return opts, nil
+}
+
+// parseHexColor accepts rgb, rrggbb and rrggbbaa with an optional leading #
+func parseHexColor(value string) (color.NRGBA, error) {
+	value = strings.TrimPrefix(value, "#")
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+	if len(value) == 6 {
+		value += "ff"
+	}
+	if len(value) != 8 {
+		return color.NRGBA{}, fmt.Errorf("colour must be a hex rgb, rrggbb or rrggbbaa value")
+	}
+	b, err := hex.DecodeString(value)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("colour must be a hex rgb, rrggbb or rrggbbaa value")
+	}
+	return color.NRGBA{b[0], b[1], b[2], b[3]}, nil
+}
+
+// qrHandler renders the QR code of a short link. The image only depends on the
+// short url and the options, so the ETag is derived from them and a matching
+// If-None-Match is answered before rendering anything.
+func (app *application) qrHandler(w http.ResponseWriter, r *http.Request) {
+	urlHash := r.PathValue("hash")
+
+	opts, err := parseQROptions(r.URL.Query())
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	ref, err := app.linkRefOf(r, urlHash)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	content, ok := app.shortURL(ref)
+	if !ok {
+		app.logger.Error("SHORT_LINK_BASE_URL is not set, can't render QR codes on the default domain", "uri", r.RequestURI)
+		http.Error(w, "QR codes are not available on this short domain", http.StatusServiceUnavailable)
+		return
+	}
+	if _, ok := app.liveLink(w, r, ref); !ok {
+		return
+	}
+
+	etag := qrETag(content, opts)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", QRCacheControl)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	code, err := qrcode.New(content, qrLevels[opts.ecc])
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+	if len(modules)+2*opts.quiet > opts.size {
+		app.clientError(w, r, fmt.Errorf("size %d is too small for %d modules", opts.size, len(modules)+2*opts.quiet), http.StatusBadRequest)
+		return
+	}
+
+	var body bytes.Buffer
+	switch opts.format {
+	case "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		writeQRSVG(&body, modules, opts)
+	default:
+		w.Header().Set("Content-Type", "image/png")
+		if err := png.Encode(&body, qrImage(modules, opts)); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	_, _ = body.WriteTo(w)
+}
+
+// qrImage scales modules up to an opts.size square. Pixels that don't divide
+// evenly go to the quiet zone, so the code stays centered.
+func qrImage(modules [][]bool, opts qrOptions) image.Image {
+	total := len(modules) + 2*opts.quiet
+	scale := opts.size / total
+	offset := (opts.size - scale*len(modules)) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.size, opts.size), color.Palette{opts.bg, opts.fg})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				start := img.PixOffset(offset+x*scale, offset+y*scale+py)
+				for px := 0; px < scale; px++ {
+					img.Pix[start+px] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// writeQRSVG draws one path with a rectangle per horizontal run of dark modules
+func writeQRSVG(buf *bytes.Buffer, modules [][]bool, opts qrOptions) {
+	total := len(modules) + 2*opts.quiet
+	fmt.Fprintf(buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		opts.size, opts.size, total, total)
+	fmt.Fprintf(buf, `<rect width="%d" height="%d" %s/>`, total, total, svgFill(opts.bg))
+	fmt.Fprintf(buf, `<path %s d="`, svgFill(opts.fg))
+	for y, row := range modules {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(buf, "M%d %dh%dv1h-%dz", x+opts.quiet, y+opts.quiet, run, run)
+			x += run
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+}
+
+func svgFill(c color.NRGBA) string {
+	fill := fmt.Sprintf(`fill="#%02x%02x%02x"`, c.R, c.G, c.B)
+	if c.A != 0xff {
+		fill += fmt.Sprintf(` fill-opacity="%.3f"`, float64(c.A)/0xff)
+	}
+	return fill
+}
+
+func qrETag(content string, opts qrOptions) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s|%x|%x|%d",
+		content, opts.format, opts.size, opts.ecc, opts.fg, opts.bg, opts.quiet)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// shortURL is the public address of a short link that goes into its QR code.
+// Links on custom domains are served over https, links on the default domain
+// have no address without a base url.
+func (app *application) shortURL(ref linkRef) (string, bool) {
+	if ref.hostname != "" {
+		return "https://" + ref.hostname + "/" + ref.hash, true
+	}
+	if app.baseURL == "" {
+		return "", false
+	}
+	return app.baseURL + ref.hash, true
+}
@@ -10,6 +10,8 @@ func (app *application) routes() http.Handler {
 	standard := alice.New(app.recoverPanic, app.logRequest)
 
 	mux.HandleFunc("GET /", app.redirectHandler)
+	mux.HandleFunc("POST /", app.unlockHandler)
+	mux.HandleFunc("GET /{hash}/qr", app.qrHandler)
 
 	return standard.Then(mux)
 }
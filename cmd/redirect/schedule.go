@@ -0,0 +1,75 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/schedule"
+	"strconv"
+	"time"
+)
+
+var unavailableTemplate = template.Must(template.New("unavailable").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Link not available</title>
+</head>
+<body>
+    {{if .OpensAt}}
+    <h1>This link is not available yet</h1>
+    <p>Come back after <time datetime="{{.OpensAt.Format "2006-01-02T15:04:05Z07:00"}}">{{.OpensAt.Format "Mon, 02 Jan 2006 15:04 MST"}}</time>.</p>
+    {{else}}
+    <h1>This link is no longer available</h1>
+    {{end}}
+</body>
+</html>
+`))
+
+// linkWindow is when dbLink may be visited
+func linkWindow(dbLink database.Link) (schedule.Window, error) {
+	var window schedule.Window
+	if dbLink.NotBefore.Valid {
+		window.NotBefore = dbLink.NotBefore.Time
+	}
+	if dbLink.NotAfter.Valid {
+		window.NotAfter = dbLink.NotAfter.Time
+	}
+	if dbLink.ScheduleDays.Valid {
+		loc, err := time.LoadLocation(dbLink.ScheduleTz.String)
+		if err != nil {
+			return schedule.Window{}, err
+		}
+		window.Recurring = &schedule.Recurring{
+			Days:     int(dbLink.ScheduleDays.Int16),
+			Start:    time.Duration(dbLink.ScheduleStart.Microseconds) * time.Microsecond,
+			End:      time.Duration(dbLink.ScheduleEnd.Microseconds) * time.Microsecond,
+			Location: loc,
+		}
+	}
+	return window, nil
+}
+
+// serveInactive answers a visit outside of the link's schedule, with a
+// redirect to the fallback url if it has one.
+func (app *application) serveInactive(w http.ResponseWriter, r *http.Request, entry cachedLink) {
+	if entry.Fallback != "" {
+		http.Redirect(w, r, entry.Fallback, http.StatusFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusGone
+	if entry.OpensAt != nil {
+		status = http.StatusServiceUnavailable
+		retryAfter := max(int(time.Until(*entry.OpensAt).Seconds())+1, 1)
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	}
+	w.WriteHeader(status)
+	if err := unavailableTemplate.Execute(w, entry); err != nil {
+		app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
+	}
+}
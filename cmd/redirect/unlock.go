@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const UnlockCookieTTL = 15 * time.Minute
+
+var unlockTemplate = template.Must(template.New("unlock").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <meta name="robots" content="noindex">
+    <title>Protected link</title>
+</head>
+<body>
+    <h1>This link is password protected</h1>
+    {{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+    <form method="post">
+        <label for="password">Password</label>
+        <input id="password" name="password" type="password" autocomplete="current-password" required autofocus>
+        <button type="submit">Unlock</button>
+    </form>
+</body>
+</html>
+`))
+
+func (app *application) renderUnlockForm(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := unlockTemplate.Execute(w, struct{ Error string }{errMsg}); err != nil {
+		app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
+	}
+}
+
+func unlockCookieName(urlHash string) string {
+	return "link_unlock_" + urlHash
+}
+
+// setUnlockCookie lets the visitor through a protected link for UnlockCookieTTL.
+// The value is the expiry and an HMAC over the link and that expiry.
+func (app *application) setUnlockCookie(w http.ResponseWriter, ref linkRef) {
+	expires := time.Now().Add(UnlockCookieTTL)
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     unlockCookieName(ref.hash),
+		Value:    expiresStr + "." + app.signUnlock(ref.cacheKey(), expiresStr),
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
+
+func (app *application) hasUnlockCookie(r *http.Request, ref linkRef) bool {
+	cookie, err := r.Cookie(unlockCookieName(ref.hash))
+	if err != nil {
+		return false
+	}
+	expiresStr, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(app.signUnlock(ref.cacheKey(), expiresStr)))
+}
+
+func (app *application) signUnlock(link, expires string) string {
+	mac := hmac.New(sha256.New, app.unlockSecret)
+	mac.Write([]byte(link + "|" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/variants"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// VariantCookieTTL is how long a visitor keeps their variant of a split link
+	VariantCookieTTL = 90 * 24 * time.Hour
+	// VariantStatsFlushInterval is how often served variants counted in redis
+	// are added to postgres. Counts not flushed yet are lost with redis.
+	VariantStatsFlushInterval = 10 * time.Second
+
+	// variantStatsKey is a redis hash from variantStatsField to a count
+	variantStatsKey = "variant_stats"
+)
+
+func variantCookieName(urlHash string) string {
+	return "link_variant_" + urlHash
+}
+
+// variantStatsField names a variant of a link in variantStatsKey. Variant
+// names can't contain a colon, so the last one ends the link's cache key.
+func variantStatsField(ref linkRef, variant string) string {
+	return ref.cacheKey() + ":" + variant
+}
+
+// parseVariantStatsField is the inverse of variantStatsField
+func parseVariantStatsField(field string) (linkRef, string, error) {
+	key, variant, ok := cutLast(field, ":")
+	if !ok || variant == "" {
+		return linkRef{}, "", errors.New("no variant")
+	}
+	ref := linkRef{hash: key}
+	if domain, urlHash, ok := strings.Cut(key, "/"); ok {
+		id, err := uuid.Parse(domain)
+		if err != nil {
+			return linkRef{}, "", err
+		}
+		ref = linkRef{domainID: pgtype.UUID{Bytes: id, Valid: true}, hash: urlHash}
+	}
+	return ref, variant, nil
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// serveVariant picks the visitor's variant of a split link and counts that it
+// was served. Visitors keep the variant named in their cookie as long as the
+// link still has it. Without one the pick is a hash of the link, the visitor's
+// address and User-Agent, so visitors that drop cookies mostly keep theirs too.
+func (app *application) serveVariant(w http.ResponseWriter, r *http.Request, ref linkRef, vs []variants.Variant) variants.Variant {
+	var variant variants.Variant
+	ok := false
+	if cookie, err := r.Cookie(variantCookieName(ref.hash)); err == nil {
+		variant, ok = variants.Find(vs, cookie.Value)
+	}
+	if !ok {
+		variant = variants.Pick(vs, variants.Key(ref.cacheKey(), app.clientIP(r).String(), r.UserAgent()))
+		http.SetCookie(w, &http.Cookie{
+			Name:     variantCookieName(ref.hash),
+			Value:    variant.Name,
+			MaxAge:   int(VariantCookieTTL.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+			Path:     "/",
+		})
+	}
+
+	// losing a count is better than losing the visitor
+	err := app.cache.HIncrBy(r.Context(), variantStatsKey, variantStatsField(ref, variant.Name), 1).Err()
+	if err != nil {
+		app.logger.Error("redis failed to count served variant", "hash", ref.hash, "variant", variant.Name, "err", err)
+	}
+	return variant
+}
+
+// flushVariantStats adds the served variants counted in redis to postgres every
+// VariantStatsFlushInterval, so that redirects never wait for the db.
+func (app *application) flushVariantStats(ctx context.Context) {
+	ticker := time.NewTicker(VariantStatsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.flushVariantStatsOnce(ctx)
+		}
+	}
+}
+
+// flushVariantStatsOnce moves the counts aside before reading them, replicas
+// sharing a redis each flush what they took and new visits count towards the
+// next flush. Counts that can't be written are put back.
+func (app *application) flushVariantStatsOnce(ctx context.Context) {
+	pending := variantStatsKey + ":flushing:" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := app.cache.Rename(ctx, variantStatsKey, pending).Err(); err != nil {
+		// no such key means nothing was served since the last flush
+		if err.Error() != "ERR no such key" {
+			app.logger.Error("redis failed to take served variants", "err", err)
+		}
+		return
+	}
+	counts, err := app.cache.HGetAll(ctx, pending).Result()
+	if err != nil {
+		app.logger.Error("redis failed to read served variants", "err", err)
+		return
+	}
+
+	for field, value := range counts {
+		served, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		ref, variant, err := parseVariantStatsField(field)
+		if err != nil {
+			app.logger.Error("invalid served variant", "field", field, "err", err)
+			continue
+		}
+		err = app.queries.AddVariantServed(ctx, database.AddVariantServedParams{
+			Variant:  variant,
+			Served:   served,
+			Hash:     ref.hash,
+			DomainID: ref.domainID,
+		})
+		if err != nil {
+			app.logger.Error("failed to record served variant", "hash", ref.hash, "variant", variant, "err", err)
+			if err := app.cache.HIncrBy(ctx, variantStatsKey, field, served).Err(); err != nil {
+				app.logger.Error("redis failed to put back served variant", "field", field, "err", err)
+			}
+		}
+	}
+	if err := app.cache.Del(ctx, pending).Err(); err != nil {
+		app.logger.Error("redis failed to drop flushed variants", "key", pending, "err", err)
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"testing"
+)
+
+func TestVariantStatsField(t *testing.T) {
+	domainID := pgtype.UUID{Bytes: uuid.MustParse("0190f6a4-7c2b-7d41-9a0e-3b1f2c4d5e6f"), Valid: true}
+	for _, ref := range []linkRef{
+		{hash: "abc123"},
+		{domainID: domainID, hash: "abc123"},
+		{hash: "with:colon"},
+	} {
+		field := variantStatsField(ref, "B")
+		got, variant, err := parseVariantStatsField(field)
+		if err != nil {
+			t.Fatalf("parseVariantStatsField(%q): %v", field, err)
+		}
+		if got.hash != ref.hash || got.domainID != ref.domainID || variant != "B" {
+			t.Errorf("parseVariantStatsField(%q) = %+v, %s, want %+v, B", field, got, variant, ref)
+		}
+	}
+	if _, _, err := parseVariantStatsField("abc123"); err == nil {
+		t.Error("parseVariantStatsField accepted a field without a variant")
+	}
+}
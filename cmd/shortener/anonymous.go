@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"net"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/helpers"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultAnonymousLinkTTL   = 24 * time.Hour
+	DefaultAnonymousRateLimit = 10
+	// AnonymousRateWindow is the window ANONYMOUS_RATE_LIMIT counts links in
+	AnonymousRateWindow = time.Hour
+
+	AnonymousPlan       = "anonymous"
+	QuotaAnonymousLinks = "anonymous_links"
+)
+
+// AnonymousUserID owns the links shortened without an account until they are
+// claimed. The user is created by the 0017_anonymous_links migration.
+var AnonymousUserID = uuid.Nil
+
+// anonymousOptions are the limits of shortening without an account
+type anonymousOptions struct {
+	// linkTTL is the longest an anonymous link lives
+	linkTTL time.Duration
+	// rateLimit is how many links one address can shorten per AnonymousRateWindow
+	rateLimit int64
+}
+
+// requestSession reads the anonymous browser session the gateway passed on,
+// hashed the way it is stored.
+func requestSession(r *http.Request) (string, bool) {
+	session := r.Header.Get(helpers.AnonymousSessionHeader)
+	if session == "" {
+		return "", false
+	}
+	sum := sha256.Sum256([]byte(session))
+	return hex.EncodeToString(sum[:]), true
+}
+
+// requestIP is the visitor's address as seen by the gateway
+func requestIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// shortenAnonymously creates a link for a visitor without an account. It is
+// limited per address, expires within the configured TTL, can't have an alias
+// and is owned by the anonymous user, remembering the session that created it.
+func (app *application) shortenAnonymously(w http.ResponseWriter, r *http.Request, session string, linkForm LinkSubmissionForm) {
+	if err := app.anonymousForm(&linkForm, time.Now()); err != nil {
+		app.linkFailedOrServerError(w, r, err)
+		return
+	}
+	if !app.allowAnonymous(w, r) {
+		return
+	}
+	link, err := app.prepareLink(r.Context(), linkForm)
+	if err != nil {
+		app.linkFailedOrServerError(w, r, err)
+		return
+	}
+
+	tx, err := app.db.Begin(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.queries.WithTx(tx)
+
+	// the anonymous plan is only limited per address, locking the shared user
+	// would make every anonymous request wait for the others
+	resp, err := app.createLink(r.Context(), qtx, &quota{}, AnonymousUserID, link)
+	if err != nil {
+		app.linkFailedOrServerError(w, r, err)
+		return
+	}
+	err = qtx.RecordAnonymousLink(r.Context(), database.RecordAnonymousLinkParams{
+		UserID:      AnonymousUserID,
+		Hash:        resp.ShortLink,
+		SessionHash: session,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, resp)
+}
+
+// anonymousForm rejects what anonymous links can't have and caps their expiry
+func (app *application) anonymousForm(linkForm *LinkSubmissionForm, now time.Time) error {
+	switch {
+	case linkForm.Alias != "":
+		return &linkError{http.StatusForbidden, fmt.Errorf("custom aliases need an account")}
+	case len(linkForm.Tags) > 0 || linkForm.FolderID != "":
+		return &linkError{http.StatusForbidden, fmt.Errorf("tags and folders need an account")}
+	case linkForm.ShortDomain != "":
+		return &linkError{http.StatusForbidden, fmt.Errorf("custom short domains need an account")}
+	}
+
+	latest := now.Add(app.anonymous.linkTTL)
+	if linkForm.ExpiresAt != "" {
+		expiresAt, err := parseExpiry(linkForm.ExpiresAt, now)
+		if err != nil {
+			return &linkError{http.StatusBadRequest, err}
+		}
+		if expiresAt.Before(latest) {
+			latest = expiresAt
+		}
+	}
+	linkForm.ExpiresAt = latest.Format(time.RFC3339Nano)
+	return nil
+}
+
+// allowAnonymous counts an anonymous link against the caller's address. Unlike
+// the api call quota it fails closed, nothing else limits anonymous requests.
+// It answers the request itself and returns false when the link is refused.
+func (app *application) allowAnonymous(w http.ResponseWriter, r *http.Request) bool {
+	now := time.Now()
+	window := now.Truncate(AnonymousRateWindow)
+	key := "anonymous:ip:" + requestIP(r) + ":" + strconv.FormatInt(window.Unix(), 10)
+
+	pipe := app.cache.TxPipeline()
+	incr := pipe.Incr(r.Context(), key)
+	pipe.Expire(r.Context(), key, AnonymousRateWindow)
+	if _, err := pipe.Exec(r.Context()); err != nil {
+		app.serverError(w, r, fmt.Errorf("failed to count anonymous link: %w", err))
+		return false
+	}
+
+	links := incr.Val()
+	reset := window.Add(AnonymousRateWindow)
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(app.anonymous.rateLimit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(app.anonymous.rateLimit-links, 0), 10))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+	if links > app.anonymous.rateLimit {
+		w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+		app.writeJSONError(w, r, http.StatusTooManyRequests, &QuotaExceeded{
+			Code:    CodeQuotaExceeded,
+			Quota:   QuotaAnonymousLinks,
+			Plan:    AnonymousPlan,
+			Limit:   int32(app.anonymous.rateLimit),
+			Message: fmt.Sprintf("anonymous link limit reached (%d per hour), sign up to shorten more", app.anonymous.rateLimit),
+		})
+		return false
+	}
+	return true
+}
+
+// claimLinksHandler moves the links the caller's browser shortened before
+// signing up to their account. Expired and deleted links are left behind, and
+// the claimed links count against the active links of the caller's plan.
+func (app *application) claimLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	session, ok := requestSession(r)
+	if !ok {
+		app.clientError(w, r, fmt.Errorf("no anonymous session to claim links from"), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := app.db.Begin(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.queries.WithTx(tx)
+
+	qt, err := app.lockQuota(r.Context(), qtx, userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	claimed, err := qtx.ClaimAnonymousLinks(r.Context(), database.ClaimAnonymousLinksParams{
+		AnonymousID: AnonymousUserID,
+		SessionHash: session,
+		UserID:      userID,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if qt.ActiveLinks.Valid && int(qt.ActiveLinksUsed)+len(claimed) > int(qt.ActiveLinks.Int32) {
+		qt.setHeaders(w)
+		app.linkFailedOrServerError(w, r, qt.exceeded(http.StatusPaymentRequired, QuotaActiveLinks, qt.ActiveLinks,
+			"claiming these links would go over the active link limit, delete links or upgrade your plan"))
+		return
+	}
+	if len(claimed) > 0 {
+		_, err := qtx.AddUserURLCounter(r.Context(), database.AddUserURLCounterParams{
+			Amount: int32(len(claimed)),
+			ID:     userID,
+		})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	resps, err := app.linkResponders(r.Context(), claimed...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, resps)
+}
+
+// purgeAnonymousLinks deletes anonymous links once they expired. They can't be
+// claimed anymore and nobody else can see them.
+func (app *application) purgeAnonymousLinks(ctx context.Context) {
+	purged, err := app.queries.PurgeExpiredAnonymousLinks(ctx, AnonymousUserID)
+	if err != nil {
+		app.logger.Error("failed to purge expired anonymous links", "err", err)
+	} else if purged > 0 {
+		app.logger.Info("purged expired anonymous links", "count", purged)
+	}
+}
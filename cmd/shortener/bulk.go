@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"io"
+	"mime"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/helpers"
+	"shortening-api/internal/linkpolicy"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MaxBulkRows      = 10000
+	MaxBulkBodyBytes = 10 << 20
+	// MaxBulkProtectedRows bounds the bcrypt work of a single request, every
+	// password takes a good fraction of a second to hash
+	MaxBulkProtectedRows = 100
+)
+
+type BulkResult struct {
+	Row       int        `json:"row"`
+	ShortLink string     `json:"short_link,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Reused    bool       `json:"reused,omitempty"`
+	Protected bool       `json:"protected,omitempty"`
+	MaxVisits int32      `json:"max_visits,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	ErrorCode string     `json:"error_code,omitempty"`
+}
+
+type BulkResponder struct {
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []BulkResult `json:"results"`
+}
+
+// bulkShortenHandler accepts a JSON array of link submissions, a CSV body or a
+// multipart CSV upload in the "file" field. Every row gets its own result and a
+// failing row never prevents the others from being stored.
+func (app *application) bulkShortenHandler(w http.ResponseWriter, r *http.Request) {
+	useruuid, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	rows, err := parseBulkRows(w, r)
+	if err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	if len(rows) == 0 {
+		app.clientError(w, r, fmt.Errorf("no links submitted"), http.StatusBadRequest)
+		return
+	}
+	if len(rows) > MaxBulkRows {
+		app.clientError(w, r, fmt.Errorf("too many links: %d > %d", len(rows), MaxBulkRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if protected := countProtected(rows); protected > MaxBulkProtectedRows {
+		app.clientError(w, r, fmt.Errorf("too many password protected links: %d > %d", protected, MaxBulkProtectedRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+	links, rejected, err := app.prepareBulkRows(r.Context(), rows)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	resp, qt, err := app.bulkCreateLinks(r, useruuid, links, rejected)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	qt.setHeaders(w)
+	app.writeJSON(w, r, resp)
+}
+
+// bulkCreateLinks stores all prepared rows and bumps the user's counters once,
+// inside a single transaction. Conflicting codes never raise an error in
+// InsertLink, so a failing row doesn't abort the transaction for the rows after
+// it. Rows past the user's quota fail like any other rejected row.
+func (app *application) bulkCreateLinks(r *http.Request, userID uuid.UUID, links []preparedLink, rejected []error) (BulkResponder, *quota, error) {
+	ctx := r.Context()
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return BulkResponder{}, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := app.queries.WithTx(tx)
+	qt, err := app.lockQuota(ctx, qtx, userID)
+	if err != nil {
+		return BulkResponder{}, nil, err
+	}
+	resp := BulkResponder{Results: make([]BulkResult, 0, len(links))}
+	for i := range links {
+		result := BulkResult{Row: i + 1}
+
+		err := rejected[i]
+		var link ShortLinkResponder
+		if err == nil {
+			link, err = app.createLink(ctx, qtx, qt, userID, links[i])
+		}
+		if err != nil {
+			var lErr *linkError
+			if !errors.As(err, &lErr) {
+				return BulkResponder{}, nil, err
+			}
+			result.Error = lErr.Error()
+			result.ErrorCode = linkErrorCode(lErr)
+			resp.Failed++
+			resp.Results = append(resp.Results, result)
+			continue
+		}
+
+		result.ShortLink = link.ShortLink
+		result.ExpiresAt = link.ExpiresAt
+		result.Reused = link.Reused
+		result.Protected = link.Protected
+		result.MaxVisits = link.MaxVisits
+		if !link.Reused {
+			resp.Created++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	if resp.Created > 0 {
+		_, err = qtx.AddUserURLCounter(ctx, database.AddUserURLCounterParams{
+			Amount: int32(resp.Created),
+			ID:     userID,
+		})
+		if err != nil {
+			return BulkResponder{}, nil, err
+		}
+		err = qtx.AddMonthlyLinks(ctx, database.AddMonthlyLinksParams{
+			UserID: userID,
+			Amount: int32(resp.Created),
+		})
+		if err != nil {
+			return BulkResponder{}, nil, err
+		}
+	}
+
+	return resp, qt, tx.Commit(ctx)
+}
+
+func countProtected(rows []LinkSubmissionForm) int {
+	protected := 0
+	for _, row := range rows {
+		if row.Password != "" {
+			protected++
+		}
+	}
+	return protected
+}
+
+// prepareBulkRows checks every row before bulkCreateLinks locks the user's
+// quota, so DNS lookups and password hashing never hold the lock. A rejected
+// row keeps its error at the same index and is left out when storing.
+func (app *application) prepareBulkRows(ctx context.Context, rows []LinkSubmissionForm) ([]preparedLink, []error, error) {
+	links := make([]preparedLink, len(rows))
+	rejected := make([]error, len(rows))
+	for i, row := range rows {
+		link, err := app.prepareLink(ctx, row)
+		var lErr *linkError
+		if errors.As(err, &lErr) {
+			rejected[i] = lErr
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		links[i] = link
+	}
+	return links, rejected, nil
+}
+
+// linkErrorCode is the machine readable reason of a rejected row, if it has one
+func linkErrorCode(lErr *linkError) string {
+	var violation *linkpolicy.Violation
+	if errors.As(lErr, &violation) {
+		return violation.Code
+	}
+	var exceeded *QuotaExceeded
+	if errors.As(lErr, &exceeded) {
+		return exceeded.Code
+	}
+	return ""
+}
+
+func parseBulkRows(w http.ResponseWriter, r *http.Request) ([]LinkSubmissionForm, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", helpers.ErrUnsupportedMediaType, err)
+	}
+
+	switch mediaType {
+	case "application/json":
+		var rows []LinkSubmissionForm
+		if err := helpers.DecodeJSON(w, r, &rows, MaxBulkBodyBytes); err != nil {
+			return nil, err
+		}
+		return rows, nil
+	case "text/csv":
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBulkBodyBytes)
+		return parseCSVRows(r.Body)
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBulkBodyBytes)
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseCSVRows(file)
+	default:
+		return nil, fmt.Errorf("%w: %s", helpers.ErrUnsupportedMediaType, mediaType)
+	}
+}
+
+// parseCSVRows reads link, alias, expires_at, password, max_visits and title columns. A header row is
+// optional; when present it may list the columns in any order.
+func parseCSVRows(body io.Reader) ([]LinkSubmissionForm, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := map[string]int{"link": 0, "alias": 1, "expires_at": 2, "password": 3, "max_visits": 4, "title": 5}
+	if header := records[0]; containsFold(header, "link") {
+		columns = map[string]int{}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		records = records[1:]
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	rows := make([]LinkSubmissionForm, 0, len(records))
+	for i, record := range records {
+		row := LinkSubmissionForm{
+			Link:      field(record, "link"),
+			Alias:     field(record, "alias"),
+			ExpiresAt: field(record, "expires_at"),
+			Password:  field(record, "password"),
+			Title:     field(record, "title"),
+		}
+		if maxVisits := field(record, "max_visits"); maxVisits != "" {
+			n, err := strconv.ParseInt(maxVisits, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid max_visits %q", i+1, maxVisits)
+			}
+			row.MaxVisits = int32(n)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(strings.TrimSpace(value), target) {
+			return true
+		}
+	}
+	return false
+}
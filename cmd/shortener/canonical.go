@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// trackingParams are dropped when stripping tracking parameters, on top of
+// anything starting with utm_
+var trackingParams = map[string]struct{}{
+	"fbclid":  {},
+	"gclid":   {},
+	"dclid":   {},
+	"gbraid":  {},
+	"wbraid":  {},
+	"msclkid": {},
+	"yclid":   {},
+	"igshid":  {},
+	"mc_cid":  {},
+	"mc_eid":  {},
+	"_hsenc":  {},
+	"_hsmi":   {},
+}
+
+type canonicalOptions struct {
+	sortQuery     bool
+	stripTracking bool
+}
+
+// canonicalizeURL normalizes a link so equivalent URLs hash to the same code.
+// It lowercases the scheme and host, converts IDNs to punycode, drops default
+// ports and resolves dot segments; sorting the query and removing tracking
+// parameters are opt in.
+func canonicalizeURL(raw string, opts canonicalOptions) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("link must have a scheme")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Host == "" {
+		// opaque links such as mailto: are left alone for the policy to judge
+		return u, nil
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if net.ParseIP(host) == nil {
+		host, err = idna.Lookup.ToASCII(strings.TrimSuffix(host, "."))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host: %w", err)
+		}
+	}
+	host = strings.ToLower(host)
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		// ipv6 literals keep their brackets
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	escapedPath := removeDotSegments(u.EscapedPath())
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	u.Path, err = url.PathUnescape(escapedPath)
+	if err != nil {
+		return nil, err
+	}
+	u.RawPath = escapedPath
+
+	if u.RawQuery != "" && (opts.sortQuery || opts.stripTracking) {
+		u.RawQuery = canonicalQuery(u.RawQuery, opts)
+	}
+
+	return u, nil
+}
+
+// canonicalQuery works on the raw pairs so values keep their original encoding
+func canonicalQuery(rawQuery string, opts canonicalOptions) string {
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		if opts.stripTracking && isTrackingParam(queryKey(pair)) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+	if opts.sortQuery {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return queryKey(kept[i]) < queryKey(kept[j])
+		})
+	}
+	return strings.Join(kept, "&")
+}
+
+func queryKey(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(key); err == nil {
+		return unescaped
+	}
+	return key
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	if strings.HasPrefix(key, "utm_") {
+		return true
+	}
+	_, ok := trackingParams[key]
+	return ok
+}
+
+// removeDotSegments implements RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	if path == "" {
+		return ""
+	}
+	segments := strings.Split(path, "/")
+	out := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		switch segment {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			// never pop the leading empty segment of an absolute path
+			if len(out) > 1 || (len(out) == 1 && out[0] != "") {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, segment)
+		}
+	}
+	result := strings.Join(out, "/")
+	if strings.HasPrefix(path, "/") && !strings.HasPrefix(result, "/") {
+		result = "/" + result
+	}
+	return result
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"net/url"
+	"shortening-api/internal/database"
+	"shortening-api/internal/domains"
+	"shortening-api/internal/helpers"
+	"time"
+)
+
+const (
+	CodeDomainNotVerified = "domain_not_verified"
+	// DomainLookupTimeout bounds the DNS lookup of a verification
+	DomainLookupTimeout = 10 * time.Second
+)
+
+type DomainForm struct {
+	Hostname string `form:"hostname" json:"hostname"`
+}
+
+// DomainChallenge is the DNS record that proves a user owns a domain
+type DomainChallenge struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type DomainResponder struct {
+	ID         uuid.UUID       `json:"id"`
+	Hostname   string          `json:"hostname"`
+	Verified   bool            `json:"verified"`
+	VerifiedAt *time.Time      `json:"verified_at,omitempty"`
+	Challenge  DomainChallenge `json:"challenge"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func newDomainResponder(domain database.CustomDomain) DomainResponder {
+	resp := DomainResponder{
+		ID:       domain.ID,
+		Hostname: domain.Hostname,
+		Verified: domain.VerifiedAt.Valid,
+		Challenge: DomainChallenge{
+			Type:  "TXT",
+			Name:  domains.ChallengeName(domain.Hostname),
+			Value: domains.ChallengeValue(domain.VerificationToken),
+		},
+		CreatedAt: domain.CreatedAt,
+	}
+	if domain.VerifiedAt.Valid {
+		resp.VerifiedAt = &domain.VerifiedAt.Time
+	}
+	return resp
+}
+
+// DomainNotVerified tells the user which record the verification looked for
+type DomainNotVerified struct {
+	Code      string          `json:"code"`
+	Challenge DomainChallenge `json:"challenge"`
+	Message   string          `json:"error"`
+}
+
+func (e *DomainNotVerified) Error() string {
+	return e.Message
+}
+
+func (app *application) listDomainsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	customDomains, err := app.queries.ListDomains(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	resp := make([]DomainResponder, 0, len(customDomains))
+	for _, domain := range customDomains {
+		resp = append(resp, newDomainResponder(domain))
+	}
+	app.writeJSON(w, r, resp)
+}
+
+// createDomainHandler adds a domain the user wants to shorten links on. It
+// can't be used before the challenge in the response has been published and
+// verified.
+func (app *application) createDomainHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var form DomainForm
+	if err := helpers.DecodeRequest(w, r, &form); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	hostname, err := domains.NormalizeHostname(form.Hostname)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if hostname == app.defaultHostname() {
+		app.clientError(w, r, fmt.Errorf("%s is the default short domain", hostname), http.StatusBadRequest)
+		return
+	}
+
+	token, err := domains.NewToken()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	domain, err := app.queries.CreateDomain(r.Context(), database.CreateDomainParams{
+		UserID:            userID,
+		Hostname:          hostname,
+		VerificationToken: token,
+	})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, newDomainResponder(domain))
+}
+
+// verifyDomainHandler looks up the domain's challenge record and marks the
+// domain verified when it holds the token
+func (app *application) verifyDomainHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	domainID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	domain, err := app.queries.GetDomain(r.Context(), database.GetDomainParams{ID: domainID, UserID: userID})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	if domain.VerifiedAt.Valid {
+		app.writeJSON(w, r, newDomainResponder(domain))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), DomainLookupTimeout)
+	defer cancel()
+	if err := domains.Verify(ctx, app.resolver, domain.Hostname, domain.VerificationToken); err != nil {
+		if errors.Is(err, domains.ErrNotVerified) {
+			resp := newDomainResponder(domain)
+			app.writeJSONError(w, r, http.StatusUnprocessableEntity, &DomainNotVerified{
+				Code:      CodeDomainNotVerified,
+				Challenge: resp.Challenge,
+				Message:   fmt.Sprintf("no TXT record %s with the value %s", resp.Challenge.Name, resp.Challenge.Value),
+			})
+			return
+		}
+		app.clientError(w, r, fmt.Errorf("dns lookup failed: %w", err), http.StatusBadGateway)
+		return
+	}
+
+	verified, err := app.queries.MarkDomainVerified(r.Context(), database.MarkDomainVerifiedParams{ID: domainID, UserID: userID})
+	if err != nil {
+		if isCollision(err) {
+			app.clientError(w, r, fmt.Errorf("%s is verified by another account", domain.Hostname), http.StatusConflict)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	if err := helpers.InvalidateDomain(r.Context(), app.cache, verified.Hostname); err != nil {
+		app.logger.Error("failed to invalidate cached domain", "hostname", verified.Hostname, "err", err)
+	}
+	app.writeJSON(w, r, newDomainResponder(verified))
+}
+
+// deleteDomainHandler removes a domain that has no live links left. Links in
+// the trash go with it.
+func (app *application) deleteDomainHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	domainID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	domain, err := app.queries.GetDomain(r.Context(), database.GetDomainParams{ID: domainID, UserID: userID})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	links, err := app.queries.CountLiveDomainLinks(r.Context(), pgtype.UUID{Bytes: domainID, Valid: true})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if links > 0 {
+		app.clientError(w, r, fmt.Errorf("%s still has %d links", domain.Hostname, links), http.StatusConflict)
+		return
+	}
+
+	if _, err := app.queries.DeleteDomain(r.Context(), database.DeleteDomainParams{ID: domainID, UserID: userID}); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if err := helpers.InvalidateDomain(r.Context(), app.cache, domain.Hostname); err != nil {
+		app.logger.Error("failed to invalidate cached domain", "hostname", domain.Hostname, "err", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ownedDomain resolves the short domain a link is submitted for. An empty
+// hostname is the default short domain.
+func ownedDomain(ctx context.Context, q *database.Queries, userID uuid.UUID, raw string) (pgtype.UUID, string, error) {
+	if raw == "" {
+		return pgtype.UUID{}, "", nil
+	}
+	hostname, err := domains.NormalizeHostname(raw)
+	if err != nil {
+		return pgtype.UUID{}, "", &linkError{http.StatusBadRequest, fmt.Errorf("invalid short_domain: %w", err)}
+	}
+	domain, err := q.GetUserDomainByHostname(ctx, database.GetUserDomainByHostnameParams{UserID: userID, Hostname: hostname})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return pgtype.UUID{}, "", &linkError{http.StatusBadRequest, fmt.Errorf("short domain %s not found", hostname)}
+		}
+		return pgtype.UUID{}, "", err
+	}
+	if !domain.VerifiedAt.Valid {
+		return pgtype.UUID{}, "", &linkError{http.StatusBadRequest, fmt.Errorf("short domain %s is not verified yet", hostname)}
+	}
+	return pgtype.UUID{Bytes: domain.ID, Valid: true}, hostname, nil
+}
+
+// domainHostnames maps the IDs of a user's domains to their hostnames
+func (app *application) domainHostnames(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]string, error) {
+	customDomains, err := app.queries.ListDomains(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	hostnames := make(map[uuid.UUID]string, len(customDomains))
+	for _, domain := range customDomains {
+		hostnames[domain.ID] = domain.Hostname
+	}
+	return hostnames, nil
+}
+
+// shortURL is the public address of a short link. Custom domains are served
+// over https, links on the default domain live under SHORT_LINK_BASE_URL.
+func (app *application) shortURL(hostname, urlHash string) string {
+	if hostname != "" {
+		return "https://" + hostname + "/" + urlHash
+	}
+	return app.baseURL + urlHash
+}
+
+func (app *application) defaultHostname() string {
+	u, err := url.Parse(app.baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatNDJSON = "ndjson"
+
+	// ExportPageSize is how many links are read from the database at a time
+	ExportPageSize = 500
+
+	// TagSeparator joins the tags of a link in a single CSV field
+	TagSeparator = "|"
+)
+
+// exportColumns is the CSV layout of exported links, which imports read back
+var exportColumns = []string{
+	"hash", "short_domain", "link", "title", "created_at", "expires_at", "max_visits", "visit_count", "protected",
+	"folder", "tags", "not_before", "not_after",
+	"schedule_days", "schedule_start", "schedule_end", "schedule_timezone", "fallback_url",
+	"ios_link", "android_link", "geo_targets", "variants",
+}
+
+// ExportedLink is the owner's view of a link with its folder named, so that it
+// can be imported into another account.
+type ExportedLink struct {
+	LinkResponder
+	Folder string `json:"folder,omitempty"`
+}
+
+// exportLinksHandler streams all of the caller's links as CSV or as NDJSON,
+// one link per line. It takes the same filters as listing links.
+func (app *application) exportLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	if format != ExportFormatCSV && format != ExportFormatNDJSON {
+		app.clientError(w, r, fmt.Errorf("format must be %q or %q", ExportFormatCSV, ExportFormatNDJSON), http.StatusBadRequest)
+		return
+	}
+	query.Del("limit")
+	query.Del("cursor")
+	params, err := parseListParams(query)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	params.UserID = userID
+	params.PageSize = ExportPageSize
+
+	folders, err := app.folderNames(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	filename := "links-" + time.Now().UTC().Format("20060102") + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	var write func(ExportedLink) error
+	var csvWriter *csv.Writer
+	switch format {
+	case ExportFormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		csvWriter = csv.NewWriter(w)
+		if err := csvWriter.Write(exportColumns); err != nil {
+			return
+		}
+		write = func(link ExportedLink) error {
+			return csvWriter.Write(link.csvRecord())
+		}
+	case ExportFormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(w)
+		write = func(link ExportedLink) error {
+			return encoder.Encode(link)
+		}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	for {
+		dbLinks, err := app.queries.ListUserLinks(r.Context(), params)
+		if err == nil && len(dbLinks) == 0 {
+			break
+		}
+		var links []LinkResponder
+		if err == nil {
+			links, err = app.linkResponders(r.Context(), dbLinks...)
+		}
+		if err != nil {
+			// the status is out already, all that's left is cutting the export short
+			app.logger.Error("export failed", "user", userID, "err", err)
+			return
+		}
+
+		for _, link := range links {
+			exported := ExportedLink{LinkResponder: link}
+			if link.FolderID != nil {
+				exported.Folder = folders[*link.FolderID]
+			}
+			if err := write(exported); err != nil {
+				return
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+			if csvWriter.Error() != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		if len(dbLinks) < ExportPageSize {
+			break
+		}
+		last := dbLinks[len(dbLinks)-1]
+		params.CursorCreatedAt = pgtype.Timestamptz{Time: last.CreatedAt, Valid: true}
+		params.CursorHash = pgtype.Text{String: last.Hash, Valid: true}
+	}
+}
+
+func (app *application) folderNames(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]string, error) {
+	folders, err := app.queries.ListFolders(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(folders))
+	for _, folder := range folders {
+		names[folder.ID] = folder.Name
+	}
+	return names, nil
+}
+
+func (link ExportedLink) csvRecord() []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	maxVisits := ""
+	if link.MaxVisits > 0 {
+		maxVisits = strconv.Itoa(int(link.MaxVisits))
+	}
+	var days, start, end, timezone string
+	if link.Schedule != nil {
+		days = strings.Join(link.Schedule.Days, ",")
+		start, end, timezone = link.Schedule.Start, link.Schedule.End, link.Schedule.Timezone
+	}
+	geoTargets := ""
+	if len(link.GeoTargets) > 0 {
+		// country rules have no compact form, the cell holds their json
+		encoded, _ := json.Marshal(link.GeoTargets)
+		geoTargets = string(encoded)
+	}
+	linkVariants := ""
+	if len(link.Variants) > 0 {
+		encoded, _ := json.Marshal(link.Variants)
+		linkVariants = string(encoded)
+	}
+
+	return []string{
+		escapeFormula(link.Hash),
+		link.ShortDomain,
+		escapeFormula(link.Link),
+		escapeFormula(link.Title),
+		link.CreatedAt.UTC().Format(time.RFC3339),
+		formatTime(link.ExpiresAt),
+		maxVisits,
+		strconv.Itoa(int(link.VisitCount)),
+		strconv.FormatBool(link.Protected),
+		escapeFormula(link.Folder),
+		escapeFormula(strings.Join(link.Tags, TagSeparator)),
+		formatTime(link.NotBefore),
+		formatTime(link.NotAfter),
+		days,
+		start,
+		end,
+		timezone,
+		escapeFormula(link.FallbackURL),
+		escapeFormula(link.IOSLink),
+		escapeFormula(link.AndroidLink),
+		geoTargets,
+		linkVariants,
+	}
+}
+
+// escapeFormula keeps a cell from being read as a formula when the export is
+// opened in a spreadsheet, by putting a quote in front of it. Cells starting
+// with a quote get another one, so unescapeFormula can always drop the first.
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@'", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeFormula undoes escapeFormula for cells of our own exports
+func unescapeFormula(value string) string {
+	return strings.TrimPrefix(value, "'")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVExportEscapesFormulas(t *testing.T) {
+	link := ExportedLink{
+		LinkResponder: LinkResponder{
+			Hash:      "-promo",
+			Link:      "https://example.com/?q=1",
+			Title:     "=HYPERLINK(\"https://evil.test\")",
+			CreatedAt: time.Now(),
+			Tags:      []string{"+1", "@team"},
+			IOSLink:   "'quoted",
+		},
+		Folder: "-folder",
+	}
+
+	record := link.csvRecord()
+	for i, column := range exportColumns {
+		if cell := record[i]; cell != "" && cell[0] != '\'' && strings.ContainsRune("=+-@", rune(cell[0])) {
+			t.Errorf("%s cell %q would be read as a formula", column, cell)
+		}
+	}
+
+	csvExport, _ := exportLinks(t, link)
+	rows, err := parseExportCSV(bytes.NewReader(csvExport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	form := rows[0].form
+	if form.Alias != link.Hash || form.Link != link.Link || form.Title != link.Title || form.IOSLink != link.IOSLink {
+		t.Errorf("imported %+v, want the exported values back", form)
+	}
+	if rows[0].folder != link.Folder {
+		t.Errorf("folder = %q, want %q", rows[0].folder, link.Folder)
+	}
+	if !slices.Equal(form.Tags, link.Tags) {
+		t.Errorf("tags = %q, want %q", form.Tags, link.Tags)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/helpers"
+	"time"
+)
+
+const MaxFolderChars = 100
+
+type FolderResponder struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (app *application) listFoldersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	folders, err := app.queries.ListFolders(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	resp := make([]FolderResponder, 0, len(folders))
+	for _, folder := range folders {
+		resp = append(resp, FolderResponder{folder.ID, folder.Name, folder.CreatedAt})
+	}
+	app.writeJSON(w, r, resp)
+}
+
+func (app *application) createFolderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var form NameForm
+	if err := helpers.DecodeRequest(w, r, &form); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	name, err := validateName("folder", form.Name, MaxFolderChars)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	folder, err := app.queries.CreateFolder(r.Context(), database.CreateFolderParams{UserID: userID, Name: name})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, FolderResponder{folder.ID, folder.Name, folder.CreatedAt})
+}
+
+func (app *application) renameFolderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	folderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	var form NameForm
+	if err := helpers.DecodeRequest(w, r, &form); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	name, err := validateName("folder", form.Name, MaxFolderChars)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	folder, err := app.queries.RenameFolder(r.Context(), database.RenameFolderParams{
+		Name:   name,
+		ID:     folderID,
+		UserID: userID,
+	})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, FolderResponder{folder.ID, folder.Name, folder.CreatedAt})
+}
+
+// deleteFolderHandler deletes the folder only, its links stay without a folder
+func (app *application) deleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	folderID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	deleted, err := app.queries.DeleteFolder(r.Context(), database.DeleteFolderParams{ID: folderID, UserID: userID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if deleted == 0 {
+		app.clientError(w, r, fmt.Errorf("folder %s not found", folderID), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveForm puts a selection of links in a folder. An empty FolderID takes
+// them out of their folder.
+type MoveForm struct {
+	Hashes   []string `json:"hashes"`
+	FolderID string   `json:"folder_id"`
+}
+
+type MoveResponder struct {
+	Moved int64 `json:"moved"`
+}
+
+func (app *application) moveLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var form MoveForm
+	if err := helpers.DecodeJSON(w, r, &form, helpers.MaxJSONBodyBytes); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	if err := validateSelection(form.Hashes); err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	folderID, err := ownedFolder(r.Context(), app.queries, userID, form.FolderID)
+	if err != nil {
+		app.linkFailedOrServerError(w, r, err)
+		return
+	}
+
+	moved, err := app.queries.MoveLinks(r.Context(), database.MoveLinksParams{
+		FolderID: folderID,
+		UserID:   userID,
+		Hashes:   form.Hashes,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, MoveResponder{Moved: moved})
+}
+
+// ownedFolder resolves a submitted folder id, which must belong to the user.
+// An empty id means no folder.
+func ownedFolder(ctx context.Context, q *database.Queries, userID uuid.UUID, raw string) (pgtype.UUID, error) {
+	if raw == "" {
+		return pgtype.UUID{}, nil
+	}
+	folderID, err := uuid.Parse(raw)
+	if err != nil {
+		return pgtype.UUID{}, &linkError{http.StatusBadRequest, fmt.Errorf("invalid folder_id: %w", err)}
+	}
+	_, err = q.GetFolder(ctx, database.GetFolderParams{ID: folderID, UserID: userID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return pgtype.UUID{}, &linkError{http.StatusBadRequest, fmt.Errorf("folder %s not found", folderID)}
+		}
+		return pgtype.UUID{}, err
+	}
+	return pgtype.UUID{Bytes: folderID, Valid: true}, nil
+}
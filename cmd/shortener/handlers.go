@@ -1,106 +1,533 @@
 package main
 
 import (
-	"crypto/sha256"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
-	"github.com/jxskiss/base62"
+	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"net/url"
 	"shortening-api/internal/database"
+	"shortening-api/internal/geo"
 	"shortening-api/internal/helpers"
+	"shortening-api/internal/linkpolicy"
+	"shortening-api/internal/shortcode"
+	"shortening-api/internal/variants"
+	"strings"
+	"time"
 )
 
 type ShortLinkResponder struct {
 	ShortLink string `json:"short_link"`
+	// ShortURL is the full address of the link, ShortDomain the custom domain it's on
+	ShortURL    string     `json:"short_url,omitempty"`
+	ShortDomain string     `json:"short_domain,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// Reused is true when an existing link was returned instead of a new one
+	Reused    bool  `json:"reused"`
+	Protected bool  `json:"protected,omitempty"`
+	MaxVisits int32 `json:"max_visits,omitempty"`
+	// Tags are the tags assigned by this submission
+	Tags []string `json:"tags,omitempty"`
 }
 type LinkSubmissionForm struct {
-	Link string `form:"link" json:"link"`
+	Link      string `form:"link" json:"link"`
+	Alias     string `form:"alias" json:"alias"`
+	ExpiresAt string `form:"expires_at" json:"expires_at"`
+	Password  string `form:"password" json:"password"`
+	// MaxVisits limits how often the link can be followed, 0 means no limit
+	MaxVisits int32    `form:"max_visits" json:"max_visits"`
+	Title     string   `form:"title" json:"title"`
+	Tags      []string `form:"tags" json:"tags"`
+	FolderID  string   `form:"folder_id" json:"folder_id"`
+	// ShortDomain is a verified custom domain of the user to shorten the link
+	// on, empty for the default domain
+	ShortDomain string `form:"short_domain" json:"short_domain"`
+	// NotBefore and NotAfter bound when the link can be visited, Schedule
+	// narrows that down to recurring hours. Outside of them visitors go to
+	// FallbackURL or get a "not available" page.
+	NotBefore   string        `form:"not_before" json:"not_before"`
+	NotAfter    string        `form:"not_after" json:"not_after"`
+	Schedule    *LinkSchedule `form:"schedule" json:"schedule"`
+	FallbackURL string        `form:"fallback_url" json:"fallback_url"`
+	// IOSLink and AndroidLink replace Link for visitors on those platforms,
+	// e.g. with the app's store page
+	IOSLink     string `form:"ios_link" json:"ios_link"`
+	AndroidLink string `form:"android_link" json:"android_link"`
+	// GeoTargets send visitors from some countries elsewhere, the first rule
+	// with the visitor's country wins
+	GeoTargets []geo.Rule `form:"geo_targets" json:"geo_targets"`
+	// Variants split the remaining visitors between several destinations by
+	// weight, each visitor keeps getting the same one
+	Variants []variants.Variant `form:"variants" json:"variants"`
+}
+
+// linkError is returned by prepareLink and createLink for submissions that should be answered
+// with a client error instead of a 500.
+type linkError struct {
+	status int
+	err    error
+}
+
+func (e *linkError) Error() string {
+	return e.err.Error()
+}
+
+func (e *linkError) Unwrap() error {
+	return e.err
 }
 
 func (app *application) shortenerHandler(w http.ResponseWriter, r *http.Request) {
 	var linkForm LinkSubmissionForm
 
-	if err := helpers.ParseForm(r, &linkForm); err != nil {
-		app.clientError(w, r, err, http.StatusBadRequest)
+	if err := helpers.DecodeRequest(w, r, &linkForm); err != nil {
+		app.decodeError(w, r, err)
 		return
 	}
 
-	link := linkForm.Link
-	if link == "" {
-		app.clientError(w, r, fmt.Errorf("empty link"), http.StatusBadRequest)
+	userID := r.Header.Get("X-User-ID")
+	if session, ok := requestSession(r); ok && userID == "" {
+		app.shortenAnonymously(w, r, session, linkForm)
+		return
+	}
+	app.logger.Debug("userID: " + userID)
+	useruuid, err := uuid.Parse(userID)
+	if err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
-	URL, err := url.Parse(link)
-	if err != nil || URL.Scheme == "" || URL.Host == "" {
-		app.clientError(w, r, fmt.Errorf("empty link"), http.StatusBadRequest)
+	link, err := app.prepareLink(r.Context(), linkForm)
+	if err != nil {
+		app.linkFailedOrServerError(w, r, err)
 		return
 	}
-	hash := sha256.New()
-	_, err = hash.Write([]byte(URL.String()))
+
+	// the link, its tags and the user's usage are stored together
+	tx, err := app.db.Begin(r.Context())
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	defer tx.Rollback(r.Context())
+	qtx := app.queries.WithTx(tx)
 
-	userID := r.Header.Get("X-User-ID")
-	app.logger.Debug("userID: " + userID)
-	useruuid, err := uuid.Parse(userID)
+	qt, err := app.lockQuota(r.Context(), qtx, useruuid)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	hashedURLBytes := hash.Sum(nil)
-	var encodedStr string
-	var inserted bool = false
+	resp, err := app.createLink(r.Context(), qtx, qt, useruuid, link)
+	if err != nil {
+		qt.setHeaders(w)
+		app.linkFailedOrServerError(w, r, err)
+		return
+	}
+
+	if !resp.Reused {
+		if err := qtx.AddMonthlyLinks(r.Context(), database.AddMonthlyLinksParams{UserID: useruuid, Amount: 1}); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if _, err := qtx.UpdateUserURLCounter(r.Context(), useruuid); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	qt.setHeaders(w)
+	app.writeJSON(w, r, resp)
+}
+
+// preparedLink is a submission that passed every check which doesn't need the
+// database, with its columns filled in except for the owner, folder, domain
+// and code.
+type preparedLink struct {
+	form      LinkSubmissionForm
+	canonical string
+	params    database.InsertLinkParams
+	tags      []string
+}
+
+// prepareLink validates a single submission, runs its destinations through the
+// destination policy and hashes its password. Policy checks can wait on DNS and
+// bcrypt is slow on purpose, so callers prepare links before they take the
+// user's quota lock.
+func (app *application) prepareLink(ctx context.Context, linkForm LinkSubmissionForm) (preparedLink, error) {
+	// the link is stored as submitted and is where visitors go, the canonical
+	// form is only for hashing and spotting the same link again
+	link := strings.TrimSpace(linkForm.Link)
+	URL, err := app.checkDestination(ctx, link)
+	if err != nil {
+		return preparedLink{}, err
+	}
+	canonical := URL.String()
+
+	var expiresAt pgtype.Timestamptz
+	if linkForm.ExpiresAt != "" {
+		t, err := parseExpiry(linkForm.ExpiresAt, time.Now())
+		if err != nil {
+			return preparedLink{}, &linkError{http.StatusBadRequest, err}
+		}
+		expiresAt = pgtype.Timestamptz{Time: t, Valid: true}
+	}
+
+	var passwordHash pgtype.Text
+	if linkForm.Password != "" {
+		passwordHash, err = hashLinkPassword(linkForm.Password)
+		if err != nil {
+			return preparedLink{}, err
+		}
+	}
+
+	if linkForm.MaxVisits < 0 {
+		return preparedLink{}, &linkError{http.StatusBadRequest, fmt.Errorf("max_visits must not be negative")}
+	}
+	var maxVisits pgtype.Int4
+	if linkForm.MaxVisits > 0 {
+		maxVisits = pgtype.Int4{Int32: linkForm.MaxVisits, Valid: true}
+	}
+
+	now := time.Now()
+	notBefore, err := parseWindowBound("not_before", linkForm.NotBefore, now)
+	if err != nil {
+		return preparedLink{}, &linkError{http.StatusBadRequest, err}
+	}
+	notAfter, err := parseWindowBound("not_after", linkForm.NotAfter, now)
+	if err != nil {
+		return preparedLink{}, &linkError{http.StatusBadRequest, err}
+	}
+	if notBefore.Valid && notAfter.Valid && !notBefore.Time.Before(notAfter.Time) {
+		return preparedLink{}, &linkError{http.StatusBadRequest, fmt.Errorf("not_before must be before not_after")}
+	}
+	sched, err := parseSchedule(linkForm.Schedule)
+	if err != nil {
+		return preparedLink{}, &linkError{http.StatusBadRequest, err}
+	}
+	fallbackURL, err := app.optionalDestination(ctx, linkForm.FallbackURL)
+	if err != nil {
+		return preparedLink{}, err
+	}
+	iosLink, err := app.optionalDestination(ctx, linkForm.IOSLink)
+	if err != nil {
+		return preparedLink{}, err
+	}
+	androidLink, err := app.optionalDestination(ctx, linkForm.AndroidLink)
+	if err != nil {
+		return preparedLink{}, err
+	}
+	geoTargets, err := app.geoTargets(ctx, linkForm.GeoTargets)
+	if err != nil {
+		return preparedLink{}, err
+	}
+	linkVariants, err := app.linkVariants(ctx, linkForm.Variants)
+	if err != nil {
+		return preparedLink{}, err
+	}
+
+	tags, err := normalizeTags(linkForm.Tags)
+	if err != nil {
+		return preparedLink{}, &linkError{http.StatusBadRequest, err}
+	}
+
+	params := database.InsertLinkParams{
+		Link: pgtype.Text{
+			String: link,
+			Valid:  true,
+		},
+		ExpiresAt: expiresAt,
+		CanonicalLink: pgtype.Text{
+			String: canonical,
+			Valid:  true,
+		},
+		PasswordHash: passwordHash,
+		MaxVisits:    maxVisits,
+		Title: pgtype.Text{
+			String: linkForm.Title,
+			Valid:  linkForm.Title != "",
+		},
+		Domain:        domainOf(URL),
+		NotBefore:     notBefore,
+		NotAfter:      notAfter,
+		ScheduleDays:  sched.days,
+		ScheduleStart: sched.start,
+		ScheduleEnd:   sched.end,
+		ScheduleTz:    sched.timezone,
+		FallbackUrl:   fallbackURL,
+		IosLink:       iosLink,
+		AndroidLink:   androidLink,
+		GeoTargets:    geoTargets,
+		Variants:      linkVariants,
+	}
+	return preparedLink{form: linkForm, canonical: canonical, params: params, tags: tags}, nil
+}
+
+// createLink stores a prepared submission through q, which may be bound to a
+// transaction. New links are checked against and recorded in qt, the user's
+// counters are left to the caller.
+func (app *application) createLink(ctx context.Context, q *database.Queries, qt *quota, userID uuid.UUID, link preparedLink) (ShortLinkResponder, error) {
+	folderID, err := ownedFolder(ctx, q, userID, link.form.FolderID)
+	if err != nil {
+		return ShortLinkResponder{}, err
+	}
+	domainID, hostname, err := ownedDomain(ctx, q, userID, link.form.ShortDomain)
+	if err != nil {
+		return ShortLinkResponder{}, err
+	}
+
+	params := link.params
+	params.UserID = userID
+	params.FolderID = folderID
+	params.DomainID = domainID
+
+	isAlias := link.form.Alias != ""
+	params.CustomAlias = isAlias && !qt.importing
+	if err := qt.allow(isAlias); err != nil {
+		return ShortLinkResponder{}, err
+	}
+
+	resp, err := app.storeLink(ctx, q, link.form.Alias, link.canonical, params)
+	if err != nil {
+		return ShortLinkResponder{}, err
+	}
+	if !resp.Reused {
+		qt.record(isAlias)
+	}
+	resp.ShortDomain = hostname
+	resp.ShortURL = app.shortURL(hostname, resp.ShortLink)
+	if len(link.tags) > 0 {
+		if _, err := tagLinks(ctx, q, userID, []string{resp.ShortLink}, link.tags); err != nil {
+			return ShortLinkResponder{}, err
+		}
+		resp.Tags = link.tags
+	}
+	return resp, nil
+}
 
-	for i := 7; i < 10; i++ {
-		if inserted {
-			break
+// storeLink inserts params under alias, or under a generated code when alias is
+// empty. An identical link the user already has is returned instead of a new one.
+func (app *application) storeLink(ctx context.Context, q *database.Queries, alias, canonical string, params database.InsertLinkParams) (ShortLinkResponder, error) {
+	var err error
+	if alias != "" {
+		if err := app.validateAlias(alias); err != nil {
+			return ShortLinkResponder{}, &linkError{http.StatusBadRequest, err}
+		}
+		params.Hash = alias
+		_, err = q.InsertLink(ctx, params)
+		if err != nil {
+			if isCollision(err) {
+				return ShortLinkResponder{}, &linkError{http.StatusConflict, fmt.Errorf("alias %q is already taken", alias)}
+			}
+			return ShortLinkResponder{}, err
 		}
+		return newShortLinkResponder(params), nil
+	}
 
-		encodedStr = base62.EncodeToString(hashedURLBytes[:i])
-		_, err = app.queries.GetLink(r.Context(), encodedStr)
+	for attempt := 0; attempt < shortcode.MaxAttempts; attempt++ {
+		params.Hash, err = app.codes.Generate(ctx, canonical, attempt)
+		if err != nil {
+			return ShortLinkResponder{}, err
+		}
+
+		// insert first and only look at the existing row when the code is taken
+		_, err = q.InsertLink(ctx, params)
+		if err == nil {
+			return newShortLinkResponder(params), nil
+		}
+		if !isCollision(err) {
+			// db failed for some reason
+			return ShortLinkResponder{}, err
+		}
+
+		existing, err := q.GetDomainLink(ctx, database.GetDomainLinkParams{
+			Hash:     params.Hash,
+			DomainID: params.DomainID,
+		})
 		if err != nil {
 			if errors.Is(err, sql.ErrNoRows) {
-				// insert the link into db
-				_, err = app.queries.InsertLink(r.Context(), database.InsertLinkParams{
-					Hash:   encodedStr,
-					UserID: useruuid,
-					Link: pgtype.Text{
-						String: link,
-						Valid:  true,
-					},
-				})
-				if err != nil {
-					app.serverError(w, r, err)
-					return
-				}
-				inserted = true
-			} else {
-				// db failed for some reason
-				app.serverError(w, r, err)
-				return
+				// the conflicting row is gone already or the user has the code
+				// on another domain, move on to the next code
+				continue
 			}
+			return ShortLinkResponder{}, err
+		}
+		// the same user shortening the same url again gets the same code back,
+		// unless either link is password protected, visit limited, scheduled or
+		// targets devices or countries or splits its visitors.
+		// Anonymous links are never shared, each session can claim its own.
+		// Only hash codes are derived from the url, with any other strategy a
+		// taken code belongs to an unrelated link.
+		if shortcode.Deterministic(app.codes) && params.UserID != AnonymousUserID &&
+			!params.PasswordHash.Valid && !params.MaxVisits.Valid && !isScheduled(params.NotBefore, params.NotAfter, params.ScheduleDays) &&
+			!isTargeted(params.IosLink, params.AndroidLink, params.GeoTargets, params.Variants) && isSameLink(existing, params.UserID, canonical) {
+			resp := ShortLinkResponder{ShortLink: existing.Hash}
+			if existing.ExpiresAt.Valid {
+				resp.ExpiresAt = &existing.ExpiresAt.Time
+			}
+			resp.Reused = true
+			return resp, nil
 		}
 	}
 
-	if inserted {
-		// we don't care that much about counter failing
-		_, _ = app.queries.UpdateUserURLCounter(r.Context(), useruuid)
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(ShortLinkResponder{encodedStr}); err != nil {
-			app.serverError(w, r, err)
-			return
+	// some sorcery with the links
+	return ShortLinkResponder{}, &linkError{http.StatusBadRequest, fmt.Errorf("tried %d codes but all of them collided", shortcode.MaxAttempts)}
+}
+
+// hashLinkPassword checks the length of a link password and hashes it
+func hashLinkPassword(password string) (pgtype.Text, error) {
+	if !MinChars(password, LinkPasswordMinChars) || len(password) > LinkPasswordMaxBytes {
+		return pgtype.Text{}, &linkError{http.StatusBadRequest, fmt.Errorf("password must be between %d characters and %d bytes", LinkPasswordMinChars, LinkPasswordMaxBytes)}
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), LinkPasswordCost)
+	if err != nil {
+		return pgtype.Text{}, err
+	}
+	return pgtype.Text{String: string(hashed), Valid: true}, nil
+}
+
+// checkDestination canonicalizes a submitted destination and runs it through
+// the destination policy.
+func (app *application) checkDestination(ctx context.Context, link string) (*url.URL, error) {
+	if link == "" {
+		return nil, &linkError{http.StatusBadRequest, fmt.Errorf("empty link")}
+	}
+
+	URL, err := canonicalizeURL(link, app.canonical)
+	if err != nil {
+		return nil, &linkError{http.StatusBadRequest, fmt.Errorf("invalid link: %w", err)}
+	}
+
+	if err := app.policy.Check(ctx, URL); err != nil {
+		var violation *linkpolicy.Violation
+		if errors.As(err, &violation) {
+			return nil, &linkError{http.StatusUnprocessableEntity, violation}
 		}
-	} else {
-		// some sorcery with the links
-		app.clientError(w, r, fmt.Errorf("tried 3 times with hash but failed"), http.StatusBadRequest)
+		return nil, err
+	}
+	if URL.Host == "" {
+		return nil, &linkError{http.StatusBadRequest, fmt.Errorf("invalid link: missing host")}
+	}
+	return URL, nil
+}
+
+// optionalDestination checks a destination that may be left empty, like a
+// fallback or a device link. Like the link itself it is kept as submitted.
+func (app *application) optionalDestination(ctx context.Context, link string) (pgtype.Text, error) {
+	link = strings.TrimSpace(link)
+	if link == "" {
+		return pgtype.Text{}, nil
+	}
+	if _, err := app.checkDestination(ctx, link); err != nil {
+		return pgtype.Text{}, err
+	}
+	return pgtype.Text{String: link, Valid: true}, nil
+}
+
+// geoTargets checks country rules and their destinations and encodes them for
+// the geo_targets column, nil when there are none
+func (app *application) geoTargets(ctx context.Context, rules []geo.Rule) ([]byte, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	rules, err := geo.NormalizeRules(rules)
+	if err != nil {
+		return nil, &linkError{http.StatusBadRequest, err}
+	}
+	for i := range rules {
+		rules[i].Link = strings.TrimSpace(rules[i].Link)
+		if _, err := app.checkDestination(ctx, rules[i].Link); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(rules)
+}
+
+// linkVariants checks the split destinations of a link and encodes them for
+// the variants column, nil when the link isn't split
+func (app *application) linkVariants(ctx context.Context, vs []variants.Variant) ([]byte, error) {
+	if len(vs) == 0 {
+		return nil, nil
+	}
+	vs, err := variants.Normalize(vs)
+	if err != nil {
+		return nil, &linkError{http.StatusBadRequest, err}
+	}
+	for i := range vs {
+		vs[i].Link = strings.TrimSpace(vs[i].Link)
+		if _, err := app.checkDestination(ctx, vs[i].Link); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(vs)
+}
+
+// domainOf is the host a link is listed under when filtering by domain
+func domainOf(u *url.URL) pgtype.Text {
+	host := u.Hostname()
+	return pgtype.Text{String: host, Valid: host != ""}
+}
+
+// isCollision reports whether an insert failed because the code is taken.
+// InsertLink skips conflicting rows and returns no rows, a unique violation
+// can still surface from other constraints.
+func isCollision(err error) bool {
+	if errors.Is(err, sql.ErrNoRows) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// isCheckViolation reports whether err comes from the named check constraint
+func isCheckViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23514" && pgErr.ConstraintName == constraint
+}
+
+// isSameLink reports whether an existing row is a live link from the same
+// owner to the same canonical destination, as opposed to a real hash collision.
+func isSameLink(existing database.Link, userID uuid.UUID, canonical string) bool {
+	destination := existing.Link.String
+	if existing.CanonicalLink.Valid {
+		destination = existing.CanonicalLink.String
+	}
+	if existing.UserID != userID || destination != canonical || existing.DeletedAt.Valid ||
+		existing.PasswordHash.Valid || existing.MaxVisits.Valid ||
+		isScheduled(existing.NotBefore, existing.NotAfter, existing.ScheduleDays) ||
+		isTargeted(existing.IosLink, existing.AndroidLink, existing.GeoTargets, existing.Variants) {
+		return false
+	}
+	return !existing.ExpiresAt.Valid || existing.ExpiresAt.Time.After(time.Now())
+}
+
+func isScheduled(notBefore, notAfter pgtype.Timestamptz, scheduleDays pgtype.Int2) bool {
+	return notBefore.Valid || notAfter.Valid || scheduleDays.Valid
+}
+
+// isTargeted reports whether a link sends some visitors elsewhere by their
+// device or country or splits them between variants
+func isTargeted(iosLink, androidLink pgtype.Text, geoTargets, linkVariants []byte) bool {
+	return iosLink.Valid || androidLink.Valid || geoTargets != nil || linkVariants != nil
+}
+
+func newShortLinkResponder(params database.InsertLinkParams) ShortLinkResponder {
+	resp := ShortLinkResponder{
+		ShortLink: params.Hash,
+		Protected: params.PasswordHash.Valid,
+		MaxVisits: params.MaxVisits.Int32,
+	}
+	if params.ExpiresAt.Valid {
+		resp.ExpiresAt = &params.ExpiresAt.Time
 	}
+	return resp
 }
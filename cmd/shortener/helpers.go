@@ -1,6 +1,15 @@
 package main
 
-import "net/http"
+import (
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"shortening-api/internal/helpers"
+	"shortening-api/internal/linkpolicy"
+	"strconv"
+	"time"
+)
 
 func (app *application) serverError(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
@@ -11,3 +20,67 @@ func (app *application) clientError(w http.ResponseWriter, r *http.Request, err
 	app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
 	http.Error(w, http.StatusText(status), status)
 }
+
+func (app *application) writeJSON(w http.ResponseWriter, r *http.Request, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// decodeError answers a request whose body could not be decoded
+func (app *application) decodeError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, helpers.ErrUnsupportedMediaType) {
+		app.clientError(w, r, err, http.StatusUnsupportedMediaType)
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.Is(err, helpers.ErrBodyTooLarge) || errors.As(err, &maxBytesErr) {
+		app.clientError(w, r, err, http.StatusRequestEntityTooLarge)
+		return
+	}
+	app.clientError(w, r, err, http.StatusBadRequest)
+}
+
+// linkFailed answers a rejected link submission. Policy violations and quota
+// errors get a structured body so clients can tell why the link was refused.
+func (app *application) linkFailed(w http.ResponseWriter, r *http.Request, lErr *linkError) {
+	var violation *linkpolicy.Violation
+	if errors.As(lErr, &violation) {
+		app.writeJSONError(w, r, lErr.status, violation)
+		return
+	}
+	var exceeded *QuotaExceeded
+	if errors.As(lErr, &exceeded) {
+		if exceeded.Quota == QuotaMonthlyLinks {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(nextMonth(time.Now())).Seconds())+1))
+		}
+		app.writeJSONError(w, r, lErr.status, exceeded)
+		return
+	}
+	app.clientError(w, r, lErr, lErr.status)
+}
+
+// writeJSONError answers with status and err encoded as the body
+func (app *application) writeJSONError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	app.logger.Error(err.Error(), "method: ", r.Method, " uri: ", r.RequestURI)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(err)
+}
+
+// linkFailedOrServerError answers rejected submissions with linkFailed and
+// anything else with a 500.
+func (app *application) linkFailedOrServerError(w http.ResponseWriter, r *http.Request, err error) {
+	var lErr *linkError
+	if errors.As(err, &lErr) {
+		app.linkFailed(w, r, lErr)
+		return
+	}
+	app.serverError(w, r, err)
+}
+
+// requestUserID reads the user the gateway authenticated the request for
+func requestUserID(r *http.Request) (uuid.UUID, error) {
+	return uuid.Parse(r.Header.Get("X-User-ID"))
+}
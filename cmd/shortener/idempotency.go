@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+	MaxIdempotencyKey = 255
+	// IdempotencyTTL is how long a response is replayed for retries
+	IdempotencyTTL = 24 * time.Hour
+	// IdempotencyLockTTL bounds how long a crashed request keeps its key busy
+	IdempotencyLockTTL = 5 * time.Minute
+)
+
+// idempotentResponse is what redis keeps for a (user, key) pair. A pending
+// record marks a request that is still running.
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Pending     bool        `json:"pending,omitempty"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// idempotent replays the first response for a repeated Idempotency-Key, so
+// clients can safely retry requests that create links. A key is bound to the
+// request body it was first used with. Server errors and 429s aren't stored,
+// retrying those runs the request again.
+func (app *application) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > MaxIdempotencyKey || strings.ContainsFunc(key, func(c rune) bool { return c < ' ' || c > '~' }) {
+			app.clientError(w, r, fmt.Errorf("%s must be at most %d printable ascii characters", IdempotencyHeader, MaxIdempotencyKey), http.StatusBadRequest)
+			return
+		}
+		owner, err := idempotencyOwner(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBulkBodyBytes))
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				app.clientError(w, r, err, http.StatusRequestEntityTooLarge)
+				return
+			}
+			app.clientError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		redisKey := "idempotency:" + owner + ":" + key
+		fingerprint := requestFingerprint(r, body)
+
+		pending, err := json.Marshal(idempotentResponse{Fingerprint: fingerprint, Pending: true})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		claimed, err := app.cache.SetNX(r.Context(), redisKey, pending, IdempotencyLockTTL).Result()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if !claimed {
+			app.replay(w, r, redisKey, fingerprint)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		// the response is out already, storing it must not depend on the client
+		ctx := context.WithoutCancel(r.Context())
+		if rec.status >= http.StatusInternalServerError || rec.status == http.StatusTooManyRequests {
+			if err := app.cache.Del(ctx, redisKey).Err(); err != nil {
+				app.logger.Error("failed to release idempotency key", "key", key, "err", err)
+			}
+			return
+		}
+		stored, err := json.Marshal(idempotentResponse{
+			Fingerprint: fingerprint,
+			Status:      rec.status,
+			Header:      replayedHeaders(rec.Header()),
+			Body:        rec.body.Bytes(),
+		})
+		if err == nil {
+			err = app.cache.Set(ctx, redisKey, stored, IdempotencyTTL).Err()
+		}
+		if err != nil {
+			app.logger.Error("failed to store idempotent response", "key", key, "err", err)
+		}
+	})
+}
+
+// replay answers a request whose key was used before
+func (app *application) replay(w http.ResponseWriter, r *http.Request, redisKey, fingerprint string) {
+	value, err := app.cache.Get(r.Context(), redisKey).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			// the first request just failed and released the key
+			app.clientError(w, r, fmt.Errorf("request with this %s was interrupted, retry it", IdempotencyHeader), http.StatusConflict)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	var stored idempotentResponse
+	if err := json.Unmarshal(value, &stored); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if stored.Fingerprint != fingerprint {
+		app.clientError(w, r, fmt.Errorf("%s was already used with a different request", IdempotencyHeader), http.StatusUnprocessableEntity)
+		return
+	}
+	if stored.Pending {
+		w.Header().Set("Retry-After", "1")
+		app.clientError(w, r, fmt.Errorf("a request with this %s is still in progress", IdempotencyHeader), http.StatusConflict)
+		return
+	}
+
+	for name, values := range stored.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	_, _ = w.Write(stored.Body)
+}
+
+// idempotencyOwner scopes keys to the user, or to the browser session of
+// anonymous requests
+func idempotencyOwner(r *http.Request) (string, error) {
+	if session, ok := requestSession(r); ok && r.Header.Get("X-User-ID") == "" {
+		return "anonymous:" + session, nil
+	}
+	userID, err := requestUserID(r)
+	if err != nil {
+		return "", err
+	}
+	return userID.String(), nil
+}
+
+// requestFingerprint identifies what a key was used for
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n%s\n", r.Method, r.URL.Path, r.Header.Get("Content-Type"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayedHeaders keeps the headers that describe the response itself. Rate
+// limit headers belong to the request that is being answered and are left out.
+func replayedHeaders(header http.Header) http.Header {
+	kept := http.Header{}
+	for name, values := range header {
+		if name == "Content-Type" || strings.HasPrefix(name, "X-Quota-") {
+			kept[name] = values
+		}
+	}
+	return kept
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
@@ -0,0 +1,705 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"io"
+	"mime"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/geo"
+	"shortening-api/internal/helpers"
+	"shortening-api/internal/variants"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// ImportSourceShortener is our own export, as CSV or NDJSON
+	ImportSourceShortener = "shortener"
+	// ImportSourceBitly is the CSV export of Bitly
+	ImportSourceBitly = "bitly"
+
+	// ImportConflictSkip leaves out links whose code is taken, ImportConflictGenerate
+	// imports them under a new code
+	ImportConflictSkip     = "skip"
+	ImportConflictGenerate = "generate"
+
+	ImportStatusPending = "pending"
+	ImportStatusRunning = "running"
+	ImportStatusDone    = "done"
+	ImportStatusFailed  = "failed"
+
+	MaxImportRows      = 100000
+	MaxImportBodyBytes = 64 << 20
+	// ImportBatchSize is how many rows share a transaction, progress is
+	// reported after every batch
+	ImportBatchSize = 100
+
+	CodeAliasConflict = "alias_conflict"
+	// CodeLinkExpired marks rows whose expiry or not_after has passed, there
+	// is nothing left to import
+	CodeLinkExpired = "link_expired"
+)
+
+// importRow is a link to import under the code it had before
+type importRow struct {
+	row       int
+	form      LinkSubmissionForm
+	folder    string
+	protected bool
+}
+
+// ImportProblem is a row that was not imported, or not under its own code
+type ImportProblem struct {
+	Row       int    `json:"row"`
+	Code      string `json:"code,omitempty"`
+	ShortLink string `json:"short_link,omitempty"`
+	Error     string `json:"error"`
+	ErrorCode string `json:"error_code,omitempty"`
+}
+
+type ImportJobResponder struct {
+	ID         uuid.UUID       `json:"id"`
+	Source     string          `json:"source"`
+	Status     string          `json:"status"`
+	Total      int32           `json:"total"`
+	Processed  int32           `json:"processed"`
+	Created    int32           `json:"created"`
+	Conflicts  int32           `json:"conflicts"`
+	Failed     int32           `json:"failed"`
+	Problems   []ImportProblem `json:"problems,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	FinishedAt *time.Time      `json:"finished_at,omitempty"`
+}
+
+func newImportJobResponder(job database.ImportJob, withProblems bool) (ImportJobResponder, error) {
+	resp := ImportJobResponder{
+		ID:        job.ID,
+		Source:    job.Source,
+		Status:    job.Status,
+		Total:     job.Total,
+		Processed: job.Processed,
+		Created:   job.Created,
+		Conflicts: job.Conflicts,
+		Failed:    job.Failed,
+		Error:     job.Error.String,
+		CreatedAt: job.CreatedAt,
+	}
+	if job.FinishedAt.Valid {
+		resp.FinishedAt = &job.FinishedAt.Time
+	}
+	if withProblems {
+		if err := json.Unmarshal(job.Problems, &resp.Problems); err != nil {
+			return ImportJobResponder{}, err
+		}
+	}
+	return resp, nil
+}
+
+// importLinksHandler starts importing links from our own export or from a
+// Bitly CSV export, sent as the body or as a multipart upload in the "file"
+// field. Original codes are kept as aliases where they are free, on_conflict
+// decides what happens to the others. The import runs in the background and
+// is answered with the job to poll for progress.
+func (app *application) importLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	query := r.URL.Query()
+	source := query.Get("source")
+	if source == "" {
+		source = ImportSourceShortener
+	}
+	if source != ImportSourceShortener && source != ImportSourceBitly {
+		app.clientError(w, r, fmt.Errorf("source must be %q or %q", ImportSourceShortener, ImportSourceBitly), http.StatusBadRequest)
+		return
+	}
+	onConflict := query.Get("on_conflict")
+	if onConflict == "" {
+		onConflict = ImportConflictSkip
+	}
+	if onConflict != ImportConflictSkip && onConflict != ImportConflictGenerate {
+		app.clientError(w, r, fmt.Errorf("on_conflict must be %q or %q", ImportConflictSkip, ImportConflictGenerate), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := parseImportRows(w, r, source)
+	if err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	if len(rows) == 0 {
+		app.clientError(w, r, fmt.Errorf("no links submitted"), http.StatusBadRequest)
+		return
+	}
+	if len(rows) > MaxImportRows {
+		app.clientError(w, r, fmt.Errorf("too many links: %d > %d", len(rows), MaxImportRows), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	job, err := app.queries.CreateImportJob(r.Context(), database.CreateImportJobParams{
+		UserID: userID,
+		Source: source,
+		Total:  int32(len(rows)),
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	go app.runImport(job, rows, onConflict)
+
+	resp, err := newImportJobResponder(job, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (app *application) listImportsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	jobs, err := app.queries.ListImportJobs(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	resp := make([]ImportJobResponder, 0, len(jobs))
+	for _, job := range jobs {
+		jobResp, err := newImportJobResponder(job, false)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		resp = append(resp, jobResp)
+	}
+	app.writeJSON(w, r, resp)
+}
+
+// getImportHandler reports the progress of an import and the rows it had
+// problems with so far
+func (app *application) getImportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	jobID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	job, err := app.queries.GetImportJob(r.Context(), database.GetImportJobParams{ID: jobID, UserID: userID})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	resp, err := newImportJobResponder(job, true)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, resp)
+}
+
+// runImport stores rows batch by batch. It runs detached from the request
+// that started it, so a failing batch is recorded on the job.
+func (app *application) runImport(job database.ImportJob, rows []importRow, onConflict string) {
+	ctx := context.Background()
+	folders := map[string]string{}
+	for start := 0; start < len(rows); start += ImportBatchSize {
+		batch := rows[start:min(start+ImportBatchSize, len(rows))]
+		if err := app.importBatch(ctx, job, batch, onConflict, folders); err != nil {
+			app.logger.Error("import failed", "job", job.ID, "err", err)
+			app.finishImport(ctx, job, ImportStatusFailed, "import stopped after an internal error")
+			return
+		}
+	}
+	app.finishImport(ctx, job, ImportStatusDone, "")
+}
+
+func (app *application) finishImport(ctx context.Context, job database.ImportJob, status, message string) {
+	err := app.queries.FinishImportJob(ctx, database.FinishImportJobParams{
+		Status: status,
+		Error:  pgtype.Text{String: message, Valid: message != ""},
+		ID:     job.ID,
+	})
+	if err != nil {
+		app.logger.Error("failed to finish import", "job", job.ID, "err", err)
+	}
+}
+
+// importBatch stores a batch of rows and the job's progress in one
+// transaction. Like bulk shortening, a rejected row doesn't abort the others,
+// and rows are checked before the user's quota is locked.
+func (app *application) importBatch(ctx context.Context, job database.ImportJob, batch []importRow, onConflict string, folders map[string]string) error {
+	links := make([]preparedLink, len(batch))
+	rejected := make([]*ImportProblem, len(batch))
+	for i, row := range batch {
+		var err error
+		links[i], rejected[i], err = app.prepareImport(ctx, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	tx, err := app.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := app.queries.WithTx(tx)
+	qt, err := app.lockQuota(ctx, qtx, job.UserID)
+	if err != nil {
+		return err
+	}
+	qt.importing = true
+
+	progress := database.RecordImportProgressParams{ID: job.ID, Processed: int32(len(batch))}
+	problems := []ImportProblem{}
+	for i, row := range batch {
+		problem := rejected[i]
+		if problem == nil {
+			var created bool
+			created, problem, err = app.importLink(ctx, qtx, qt, job.UserID, row, links[i], onConflict, folders)
+			if err != nil {
+				return err
+			}
+			if created {
+				progress.Created++
+			}
+		}
+		if problem == nil {
+			continue
+		}
+		if problem.ErrorCode == CodeAliasConflict {
+			progress.Conflicts++
+		}
+		if problem.ShortLink == "" && problem.ErrorCode != CodeAliasConflict {
+			progress.Failed++
+		}
+		problems = append(problems, *problem)
+	}
+
+	progress.Problems, err = json.Marshal(problems)
+	if err != nil {
+		return err
+	}
+	if err := qtx.RecordImportProgress(ctx, progress); err != nil {
+		return err
+	}
+	if progress.Created > 0 {
+		_, err = qtx.AddUserURLCounter(ctx, database.AddUserURLCounterParams{
+			Amount: progress.Created,
+			ID:     job.UserID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// prepareImport checks a row like prepareLink does. Rows that can't be imported
+// come back as a problem.
+func (app *application) prepareImport(ctx context.Context, row importRow) (preparedLink, *ImportProblem, error) {
+	failed := func(err error, code string) (preparedLink, *ImportProblem, error) {
+		return preparedLink{}, &ImportProblem{Row: row.row, Code: row.form.Alias, Error: err.Error(), ErrorCode: code}, nil
+	}
+
+	if row.protected {
+		// passwords aren't exported, importing would make the link public
+		return failed(fmt.Errorf("password protected links can't be imported"), "")
+	}
+	form := row.form
+	now := time.Now()
+	for _, bound := range []struct{ field, value string }{
+		{"expires_at", form.ExpiresAt},
+		{"not_after", form.NotAfter},
+	} {
+		if t, ok := pastTime(bound.value, now); ok {
+			return failed(fmt.Errorf("link expired, %s was %s", bound.field, t.Format(time.RFC3339)), CodeLinkExpired)
+		}
+	}
+	// exports keep when a link's window opened, which has usually passed by
+	// the time they are imported. New links can't start in the past, imported
+	// ones keep their original not_before.
+	notBefore, started := pastTime(form.NotBefore, now)
+	if started {
+		form.NotBefore = ""
+	}
+
+	link, err := app.prepareLink(ctx, form)
+	if err != nil {
+		var lErr *linkError
+		if !errors.As(err, &lErr) {
+			return preparedLink{}, nil, err
+		}
+		return failed(lErr, linkErrorCode(lErr))
+	}
+	if started {
+		link.params.NotBefore = pgtype.Timestamptz{Time: notBefore, Valid: true}
+	}
+	return link, nil, nil
+}
+
+// pastTime reports whether value is an absolute RFC 3339 time that isn't after now
+func pastTime(value string, now time.Time) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+	if err != nil || t.After(now) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// importLink stores a single prepared row. Rows that couldn't keep their code
+// or couldn't be stored at all come back as a problem.
+func (app *application) importLink(ctx context.Context, q *database.Queries, qt *quota, userID uuid.UUID, row importRow, link preparedLink, onConflict string, folders map[string]string) (bool, *ImportProblem, error) {
+	failed := func(err error, code string) (bool, *ImportProblem, error) {
+		return false, &ImportProblem{Row: row.row, Code: row.form.Alias, Error: err.Error(), ErrorCode: code}, nil
+	}
+
+	if row.folder != "" {
+		folderID, err := importFolder(ctx, q, userID, row.folder, folders)
+		if err != nil {
+			var lErr *linkError
+			if errors.As(err, &lErr) {
+				return failed(lErr, "")
+			}
+			return false, nil, err
+		}
+		link.form.FolderID = folderID
+	}
+
+	var conflict error
+	if link.form.Alias != "" {
+		conflict = app.validateAlias(link.form.Alias)
+	}
+	if conflict == nil {
+		_, err := app.createLink(ctx, q, qt, userID, link)
+		if err == nil {
+			return true, nil, nil
+		}
+		var lErr *linkError
+		if !errors.As(err, &lErr) {
+			return false, nil, err
+		}
+		if lErr.status != http.StatusConflict {
+			return failed(lErr, linkErrorCode(lErr))
+		}
+		// running an import again finds the links it created before
+		existing, err := q.GetUserLink(ctx, database.GetUserLinkParams{Hash: link.form.Alias, UserID: userID})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, nil, err
+		}
+		if err == nil && !existing.DeletedAt.Valid && existing.Link.String == link.params.Link.String {
+			return false, nil, nil
+		}
+		conflict = lErr
+	}
+
+	if onConflict == ImportConflictSkip {
+		return failed(conflict, CodeAliasConflict)
+	}
+	link.form.Alias = ""
+	resp, err := app.createLink(ctx, q, qt, userID, link)
+	if err != nil {
+		var lErr *linkError
+		if !errors.As(err, &lErr) {
+			return false, nil, err
+		}
+		return failed(lErr, linkErrorCode(lErr))
+	}
+	return !resp.Reused, &ImportProblem{
+		Row:       row.row,
+		Code:      row.form.Alias,
+		ShortLink: resp.ShortLink,
+		Error:     conflict.Error(),
+		ErrorCode: CodeAliasConflict,
+	}, nil
+}
+
+// importFolder finds or creates the user's folder called name. IDs are kept in
+// folders for the rest of the import.
+func importFolder(ctx context.Context, q *database.Queries, userID uuid.UUID, name string, folders map[string]string) (string, error) {
+	name, err := validateName("folder", name, MaxFolderChars)
+	if err != nil {
+		return "", &linkError{http.StatusBadRequest, err}
+	}
+	if id, ok := folders[name]; ok {
+		return id, nil
+	}
+	folder, err := q.UpsertFolder(ctx, database.UpsertFolderParams{UserID: userID, Name: name})
+	if err != nil {
+		return "", err
+	}
+	folders[name] = folder.ID.String()
+	return folders[name], nil
+}
+
+func parseImportRows(w http.ResponseWriter, r *http.Request, source string) ([]importRow, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", helpers.ErrUnsupportedMediaType, err)
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MaxImportBodyBytes)
+
+	parseCSV := parseExportCSV
+	if source == ImportSourceBitly {
+		parseCSV = parseBitlyCSV
+	}
+	switch mediaType {
+	case "text/csv":
+		return parseCSV(r.Body)
+	case "multipart/form-data":
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseCSV(file)
+	case "application/x-ndjson":
+		if source != ImportSourceShortener {
+			return nil, fmt.Errorf("%w: %s exports are CSV", helpers.ErrUnsupportedMediaType, source)
+		}
+		return parseExportNDJSON(r.Body)
+	default:
+		return nil, fmt.Errorf("%w: %s", helpers.ErrUnsupportedMediaType, mediaType)
+	}
+}
+
+// parseExportNDJSON reads links exported as NDJSON
+func parseExportNDJSON(body io.Reader) ([]importRow, error) {
+	decoder := json.NewDecoder(body)
+	var rows []importRow
+	for i := 1; ; i++ {
+		var link ExportedLink
+		if err := decoder.Decode(&link); err != nil {
+			if errors.Is(err, io.EOF) {
+				return rows, nil
+			}
+			return nil, fmt.Errorf("line %d: %w", i, err)
+		}
+
+		form := LinkSubmissionForm{
+			Link:        link.Link,
+			Alias:       link.Hash,
+			ShortDomain: link.ShortDomain,
+			Title:       link.Title,
+			MaxVisits:   link.MaxVisits,
+			Tags:        link.Tags,
+			Schedule:    link.Schedule,
+			FallbackURL: link.FallbackURL,
+			IOSLink:     link.IOSLink,
+			AndroidLink: link.AndroidLink,
+			GeoTargets:  link.GeoTargets,
+			Variants:    link.Variants,
+		}
+		for _, bound := range []struct {
+			value *time.Time
+			dest  *string
+		}{
+			{link.ExpiresAt, &form.ExpiresAt},
+			{link.NotBefore, &form.NotBefore},
+			{link.NotAfter, &form.NotAfter},
+		} {
+			if bound.value != nil {
+				*bound.dest = bound.value.Format(time.RFC3339)
+			}
+		}
+		rows = append(rows, importRow{row: i, form: form, folder: link.Folder, protected: link.Protected})
+	}
+}
+
+// parseExportCSV reads links exported as CSV. The header row is required, only
+// the link column is. Cells that the export escaped against spreadsheet
+// formulas are read back as they were.
+func parseExportCSV(body io.Reader) ([]importRow, error) {
+	records, cell, err := readImportCSV(body, map[string][]string{
+		"link":     {"link"},
+		"hash":     {"hash", "alias"},
+		"domain":   {"short_domain"},
+		"title":    {"title"},
+		"expires":  {"expires_at"},
+		"visits":   {"max_visits"},
+		"folder":   {"folder"},
+		"tags":     {"tags"},
+		"protect":  {"protected"},
+		"from":     {"not_before"},
+		"until":    {"not_after"},
+		"days":     {"schedule_days"},
+		"start":    {"schedule_start"},
+		"end":      {"schedule_end"},
+		"timezone": {"schedule_timezone"},
+		"fallback": {"fallback_url"},
+		"ios":      {"ios_link"},
+		"android":  {"android_link"},
+		"geo":      {"geo_targets"},
+		"variants": {"variants"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	field := func(record []string, name string) string {
+		return unescapeFormula(cell(record, name))
+	}
+
+	rows := make([]importRow, 0, len(records))
+	for i, record := range records {
+		row := importRow{
+			row: i + 1,
+			form: LinkSubmissionForm{
+				Link:        field(record, "link"),
+				Alias:       field(record, "hash"),
+				ShortDomain: field(record, "domain"),
+				Title:       field(record, "title"),
+				ExpiresAt:   field(record, "expires"),
+				NotBefore:   field(record, "from"),
+				NotAfter:    field(record, "until"),
+				FallbackURL: field(record, "fallback"),
+				IOSLink:     field(record, "ios"),
+				AndroidLink: field(record, "android"),
+			},
+			folder:    field(record, "folder"),
+			protected: field(record, "protect") == "true",
+		}
+		if tags := field(record, "tags"); tags != "" {
+			row.form.Tags = strings.Split(tags, TagSeparator)
+		}
+		if maxVisits := field(record, "visits"); maxVisits != "" {
+			n, err := strconv.ParseInt(maxVisits, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: invalid max_visits %q", i+1, maxVisits)
+			}
+			row.form.MaxVisits = int32(n)
+		}
+		if geoTargets := field(record, "geo"); geoTargets != "" {
+			row.form.GeoTargets, err = geo.DecodeRules([]byte(geoTargets))
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+		}
+		if linkVariants := field(record, "variants"); linkVariants != "" {
+			row.form.Variants, err = variants.Decode([]byte(linkVariants))
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+		}
+		if start := field(record, "start"); start != "" {
+			row.form.Schedule = &LinkSchedule{
+				Start:    start,
+				End:      field(record, "end"),
+				Timezone: field(record, "timezone"),
+			}
+			if days := field(record, "days"); days != "" {
+				row.form.Schedule.Days = strings.Split(days, ",")
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// parseBitlyCSV reads a Bitly link export. The back-half of each bitlink
+// becomes the alias, tags are comma separated.
+func parseBitlyCSV(body io.Reader) ([]importRow, error) {
+	records, field, err := readImportCSV(body, map[string][]string{
+		"link":    {"long url", "long_url", "destination"},
+		"bitlink": {"bitlink", "bitly link", "short url", "short_url"},
+		"title":   {"title"},
+		"tags":    {"tags"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]importRow, 0, len(records))
+	for i, record := range records {
+		row := importRow{
+			row: i + 1,
+			form: LinkSubmissionForm{
+				Link:  field(record, "link"),
+				Title: field(record, "title"),
+			},
+		}
+		if bitlink := strings.TrimRight(field(record, "bitlink"), "/"); bitlink != "" {
+			row.form.Alias = bitlink[strings.LastIndex(bitlink, "/")+1:]
+		}
+		if tags := field(record, "tags"); tags != "" {
+			row.form.Tags = strings.Split(tags, ",")
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// readImportCSV reads a CSV file with a header row. columns maps the fields a
+// parser wants to the header names they may go by, field looks them up in a
+// record.
+func readImportCSV(body io.Reader, columns map[string][]string) ([][]string, func([]string, string) string, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, nil
+	}
+
+	header := make(map[string]int, len(records[0]))
+	for i, name := range records[0] {
+		// spreadsheet tools like to put a byte order mark in front
+		name = strings.TrimPrefix(name, "\ufeff")
+		header[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	indexes := make(map[string]int, len(columns))
+	for field, names := range columns {
+		for _, name := range names {
+			if i, ok := header[name]; ok {
+				indexes[field] = i
+				break
+			}
+		}
+	}
+	if _, ok := indexes["link"]; !ok {
+		return nil, nil, fmt.Errorf("header row must name a %q column", columns["link"][0])
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := indexes[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	return records[1:], field, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"shortening-api/internal/linkpolicy"
+	"testing"
+	"time"
+)
+
+func testApp() *application {
+	return &application{policy: linkpolicy.New(linkpolicy.Config{})}
+}
+
+// exportLinks writes links the way exportLinksHandler does, in both formats
+func exportLinks(t *testing.T, links ...ExportedLink) (csvExport, ndjsonExport []byte) {
+	t.Helper()
+	var csvBuf, ndjsonBuf bytes.Buffer
+	csvWriter := csv.NewWriter(&csvBuf)
+	encoder := json.NewEncoder(&ndjsonBuf)
+	if err := csvWriter.Write(exportColumns); err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range links {
+		if err := csvWriter.Write(link.csvRecord()); err != nil {
+			t.Fatal(err)
+		}
+		if err := encoder.Encode(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+	csvWriter.Flush()
+	return csvBuf.Bytes(), ndjsonBuf.Bytes()
+}
+
+func TestImportRoundTrip(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	started := now.Add(-30 * 24 * time.Hour)
+	ends := now.Add(30 * 24 * time.Hour)
+	expired := now.Add(-time.Hour)
+
+	csvExport, ndjsonExport := exportLinks(t,
+		ExportedLink{LinkResponder: LinkResponder{
+			Hash:      "started",
+			Link:      "https://example.com/sale",
+			CreatedAt: started,
+			NotBefore: &started,
+			NotAfter:  &ends,
+		}},
+		ExportedLink{LinkResponder: LinkResponder{
+			Hash:      "gone",
+			Link:      "https://example.com/old",
+			CreatedAt: started,
+			ExpiresAt: &expired,
+		}},
+		ExportedLink{LinkResponder: LinkResponder{
+			Hash:      "over",
+			Link:      "https://example.com/event",
+			CreatedAt: started,
+			NotBefore: &started,
+			NotAfter:  &expired,
+		}},
+	)
+
+	parsers := map[string]func() ([]importRow, error){
+		"csv":    func() ([]importRow, error) { return parseExportCSV(bytes.NewReader(csvExport)) },
+		"ndjson": func() ([]importRow, error) { return parseExportNDJSON(bytes.NewReader(ndjsonExport)) },
+	}
+	for format, parse := range parsers {
+		t.Run(format, func(t *testing.T) {
+			rows, err := parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != 3 {
+				t.Fatalf("parsed %d rows, want 3", len(rows))
+			}
+
+			link, problem, err := testApp().prepareImport(context.Background(), rows[0])
+			if err != nil || problem != nil {
+				t.Fatalf("a link that has started wasn't imported: %v, %+v", err, problem)
+			}
+			if !link.params.NotBefore.Valid || !link.params.NotBefore.Time.Equal(started) {
+				t.Errorf("not_before = %v, want %s", link.params.NotBefore, started)
+			}
+			if !link.params.NotAfter.Valid || !link.params.NotAfter.Time.Equal(ends) {
+				t.Errorf("not_after = %v, want %s", link.params.NotAfter, ends)
+			}
+
+			for _, row := range rows[1:] {
+				_, problem, err := testApp().prepareImport(context.Background(), row)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if problem == nil || problem.ErrorCode != CodeLinkExpired {
+					t.Errorf("row %s = %+v, want a %s problem", row.form.Alias, problem, CodeLinkExpired)
+				}
+			}
+		})
+	}
+}
+
+func TestPrepareLinkRejectsPastNotBefore(t *testing.T) {
+	// only imports get to keep a not_before that has passed
+	form := LinkSubmissionForm{Link: "https://example.com/", NotBefore: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)}
+	if _, err := testApp().prepareLink(context.Background(), form); err == nil {
+		t.Error("prepareLink accepted a not_before in the past")
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"net/url"
+	"shortening-api/internal/database"
+	"shortening-api/internal/geo"
+	"shortening-api/internal/helpers"
+	"shortening-api/internal/variants"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+
+	LinkStatusActive  = "active"
+	LinkStatusExpired = "expired"
+)
+
+// LinkResponder is the owner's view of a stored link
+type LinkResponder struct {
+	Hash          string             `json:"hash"`
+	ShortDomain   string             `json:"short_domain,omitempty"`
+	ShortURL      string             `json:"short_url,omitempty"`
+	Link          string             `json:"link"`
+	CanonicalLink string             `json:"canonical_link,omitempty"`
+	Title         string             `json:"title,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+	ExpiresAt     *time.Time         `json:"expires_at,omitempty"`
+	Protected     bool               `json:"protected"`
+	MaxVisits     int32              `json:"max_visits,omitempty"`
+	VisitCount    int32              `json:"visit_count"`
+	FolderID      *uuid.UUID         `json:"folder_id,omitempty"`
+	Tags          []string           `json:"tags"`
+	NotBefore     *time.Time         `json:"not_before,omitempty"`
+	NotAfter      *time.Time         `json:"not_after,omitempty"`
+	Schedule      *LinkSchedule      `json:"schedule,omitempty"`
+	FallbackURL   string             `json:"fallback_url,omitempty"`
+	IOSLink       string             `json:"ios_link,omitempty"`
+	AndroidLink   string             `json:"android_link,omitempty"`
+	GeoTargets    []geo.Rule         `json:"geo_targets,omitempty"`
+	Variants      []variants.Variant `json:"variants,omitempty"`
+}
+
+func newLinkResponder(dbLink database.Link) LinkResponder {
+	resp := LinkResponder{
+		Hash:          dbLink.Hash,
+		Link:          dbLink.Link.String,
+		CanonicalLink: dbLink.CanonicalLink.String,
+		Title:         dbLink.Title.String,
+		CreatedAt:     dbLink.CreatedAt,
+		Protected:     dbLink.PasswordHash.Valid,
+		MaxVisits:     dbLink.MaxVisits.Int32,
+		VisitCount:    dbLink.VisitCount,
+		Tags:          []string{},
+		Schedule:      scheduleOf(dbLink),
+		FallbackURL:   dbLink.FallbackUrl.String,
+		IOSLink:       dbLink.IosLink.String,
+		AndroidLink:   dbLink.AndroidLink.String,
+	}
+	if dbLink.ExpiresAt.Valid {
+		resp.ExpiresAt = &dbLink.ExpiresAt.Time
+	}
+	if dbLink.NotBefore.Valid {
+		resp.NotBefore = &dbLink.NotBefore.Time
+	}
+	if dbLink.NotAfter.Valid {
+		resp.NotAfter = &dbLink.NotAfter.Time
+	}
+	if dbLink.FolderID.Valid {
+		folderID := uuid.UUID(dbLink.FolderID.Bytes)
+		resp.FolderID = &folderID
+	}
+	// the rules were encoded by geoTargets, they can't be invalid
+	resp.GeoTargets, _ = geo.DecodeRules(dbLink.GeoTargets)
+	resp.Variants, _ = variants.Decode(dbLink.Variants)
+	return resp
+}
+
+// linkResponders builds the owner's view of dbLinks together with their tags
+// and short URLs. All links belong to the same user.
+func (app *application) linkResponders(ctx context.Context, dbLinks ...database.Link) ([]LinkResponder, error) {
+	resps := make([]LinkResponder, 0, len(dbLinks))
+	hashes := make([]string, 0, len(dbLinks))
+	index := make(map[string]int, len(dbLinks))
+	onCustomDomain := false
+	for i, dbLink := range dbLinks {
+		resps = append(resps, newLinkResponder(dbLink))
+		hashes = append(hashes, dbLink.Hash)
+		index[dbLink.Hash] = i
+		onCustomDomain = onCustomDomain || dbLink.DomainID.Valid
+	}
+	if len(hashes) == 0 {
+		return resps, nil
+	}
+
+	hostnames := map[uuid.UUID]string{}
+	if onCustomDomain {
+		var err error
+		hostnames, err = app.domainHostnames(ctx, dbLinks[0].UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, dbLink := range dbLinks {
+		if dbLink.DomainID.Valid {
+			resps[i].ShortDomain = hostnames[dbLink.DomainID.Bytes]
+		}
+		resps[i].ShortURL = app.shortURL(resps[i].ShortDomain, dbLink.Hash)
+	}
+
+	linkTags, err := app.queries.ListLinkTags(ctx, database.ListLinkTagsParams{
+		UserID: dbLinks[0].UserID,
+		Hashes: hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, linkTag := range linkTags {
+		i := index[linkTag.LinkHash]
+		resps[i].Tags = append(resps[i].Tags, linkTag.Name)
+	}
+	return resps, nil
+}
+
+// writeLink answers with the owner's view of a single link
+func (app *application) writeLink(w http.ResponseWriter, r *http.Request, dbLink database.Link) {
+	resps, err := app.linkResponders(r.Context(), dbLink)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, resps[0])
+}
+
+// LinkListResponder is one page of links, newest first. NextCursor is empty
+// on the last page.
+type LinkListResponder struct {
+	Links      []LinkResponder `json:"links"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// listLinksHandler lists the caller's links. Supported query parameters are
+// limit, cursor, created_after, created_before, domain, status (active or
+// expired), tag, folder_id and q, a full text search over the destination and
+// title.
+func (app *application) listLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	params, err := parseListParams(r.URL.Query())
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	params.UserID = userID
+	pageSize := params.PageSize
+	// one extra row tells us whether there is a next page
+	params.PageSize++
+
+	dbLinks, err := app.queries.ListUserLinks(r.Context(), params)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var resp LinkListResponder
+	if len(dbLinks) > int(pageSize) {
+		dbLinks = dbLinks[:pageSize]
+		last := dbLinks[len(dbLinks)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.Hash)
+	}
+	resp.Links, err = app.linkResponders(r.Context(), dbLinks...)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, resp)
+}
+
+func parseListParams(query url.Values) (database.ListUserLinksParams, error) {
+	params := database.ListUserLinksParams{PageSize: DefaultPageSize}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > MaxPageSize {
+			return params, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+		}
+		params.PageSize = int32(n)
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		createdAt, hash, err := decodeCursor(cursor)
+		if err != nil {
+			return params, err
+		}
+		params.CursorCreatedAt = pgtype.Timestamptz{Time: createdAt, Valid: true}
+		params.CursorHash = pgtype.Text{String: hash, Valid: true}
+	}
+
+	for name, dest := range map[string]*pgtype.Timestamptz{
+		"created_after":  &params.CreatedAfter,
+		"created_before": &params.CreatedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return params, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dest = pgtype.Timestamptz{Time: t, Valid: true}
+		}
+	}
+
+	if domain := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(query.Get("domain"))), "."); domain != "" {
+		params.Domain = pgtype.Text{String: domain, Valid: true}
+	}
+
+	switch status := query.Get("status"); status {
+	case "":
+	case LinkStatusActive, LinkStatusExpired:
+		params.Status = pgtype.Text{String: status, Valid: true}
+	default:
+		return params, fmt.Errorf("status must be %q or %q", LinkStatusActive, LinkStatusExpired)
+	}
+
+	if tag := strings.TrimSpace(query.Get("tag")); tag != "" {
+		params.Tag = pgtype.Text{String: tag, Valid: true}
+	}
+	if folder := query.Get("folder_id"); folder != "" {
+		folderID, err := uuid.Parse(folder)
+		if err != nil {
+			return params, fmt.Errorf("invalid folder_id: %w", err)
+		}
+		params.FolderID = pgtype.UUID{Bytes: folderID, Valid: true}
+	}
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		params.Query = pgtype.Text{String: q, Valid: true}
+	}
+
+	return params, nil
+}
+
+// cursors point at the last link of the previous page. They are opaque to
+// clients but just encode its creation time and hash.
+func encodeCursor(createdAt time.Time, hash string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(createdAt.UTC().Format(time.RFC3339Nano) + "|" + hash))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	invalid := fmt.Errorf("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", invalid
+	}
+	ts, hash, found := strings.Cut(string(raw), "|")
+	if !found || hash == "" {
+		return time.Time{}, "", invalid
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, "", invalid
+	}
+	return createdAt, hash, nil
+}
+
+// getLinkHandler shows one of the caller's links. Links of other users and
+// deleted links are reported as missing.
+func (app *application) getLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	urlHash := r.PathValue("hash")
+
+	dbLink, err := app.queries.GetUserLink(r.Context(), database.GetUserLinkParams{
+		Hash:   urlHash,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	if dbLink.DeletedAt.Valid {
+		app.clientError(w, r, fmt.Errorf("link %s not found", urlHash), http.StatusNotFound)
+		return
+	}
+
+	app.writeLink(w, r, dbLink)
+}
+
+// LinkUpdateForm only changes the fields that are present. An empty
+// expires_at, not_before, not_after, fallback_url, ios_link or android_link
+// removes it, and so does an empty schedule object or geo_targets or variants
+// list.
+type LinkUpdateForm struct {
+	Link        *string             `form:"link" json:"link"`
+	ExpiresAt   *string             `form:"expires_at" json:"expires_at"`
+	Title       *string             `form:"title" json:"title"`
+	NotBefore   *string             `form:"not_before" json:"not_before"`
+	NotAfter    *string             `form:"not_after" json:"not_after"`
+	Schedule    *LinkSchedule       `form:"schedule" json:"schedule"`
+	FallbackURL *string             `form:"fallback_url" json:"fallback_url"`
+	IOSLink     *string             `form:"ios_link" json:"ios_link"`
+	AndroidLink *string             `form:"android_link" json:"android_link"`
+	GeoTargets  *[]geo.Rule         `form:"geo_targets" json:"geo_targets"`
+	Variants    *[]variants.Variant `form:"variants" json:"variants"`
+}
+
+func (f *LinkUpdateForm) empty() bool {
+	return f.Link == nil && f.ExpiresAt == nil && f.Title == nil &&
+		f.NotBefore == nil && f.NotAfter == nil && f.Schedule == nil && f.FallbackURL == nil &&
+		f.IOSLink == nil && f.AndroidLink == nil && f.GeoTargets == nil && f.Variants == nil
+}
+
+func (app *application) updateLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	urlHash := r.PathValue("hash")
+
+	var form LinkUpdateForm
+	if err := helpers.DecodeRequest(w, r, &form); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	if form.empty() {
+		app.clientError(w, r, fmt.Errorf("nothing to update"), http.StatusBadRequest)
+		return
+	}
+
+	params := database.UpdateLinkParams{
+		Hash:   urlHash,
+		UserID: userID,
+	}
+	if form.Link != nil {
+		URL, err := app.checkDestination(r.Context(), *form.Link)
+		if err != nil {
+			app.linkFailedOrServerError(w, r, err)
+			return
+		}
+		params.Link = pgtype.Text{String: strings.TrimSpace(*form.Link), Valid: true}
+		params.CanonicalLink = pgtype.Text{String: URL.String(), Valid: true}
+		params.Domain = domainOf(URL)
+	}
+	if form.ExpiresAt != nil {
+		params.SetExpiresAt = true
+		if *form.ExpiresAt != "" {
+			t, err := parseExpiry(*form.ExpiresAt, time.Now())
+			if err != nil {
+				app.clientError(w, r, err, http.StatusBadRequest)
+				return
+			}
+			params.ExpiresAt = pgtype.Timestamptz{Time: t, Valid: true}
+		}
+	}
+	if form.Title != nil {
+		params.Title = pgtype.Text{String: *form.Title, Valid: true}
+	}
+	if form.NotBefore != nil {
+		params.SetNotBefore = true
+		if params.NotBefore, err = parseWindowBound("not_before", *form.NotBefore, time.Now()); err != nil {
+			app.clientError(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if form.NotAfter != nil {
+		params.SetNotAfter = true
+		if params.NotAfter, err = parseWindowBound("not_after", *form.NotAfter, time.Now()); err != nil {
+			app.clientError(w, r, err, http.StatusBadRequest)
+			return
+		}
+	}
+	if form.Schedule != nil {
+		sched, err := parseSchedule(form.Schedule)
+		if err != nil {
+			app.clientError(w, r, err, http.StatusBadRequest)
+			return
+		}
+		params.SetSchedule = true
+		params.ScheduleDays = sched.days
+		params.ScheduleStart = sched.start
+		params.ScheduleEnd = sched.end
+		params.ScheduleTz = sched.timezone
+	}
+	for _, target := range []struct {
+		value *string
+		set   *bool
+		dest  *pgtype.Text
+	}{
+		{form.FallbackURL, &params.SetFallbackUrl, &params.FallbackUrl},
+		{form.IOSLink, &params.SetIosLink, &params.IosLink},
+		{form.AndroidLink, &params.SetAndroidLink, &params.AndroidLink},
+	} {
+		if target.value == nil {
+			continue
+		}
+		*target.set = true
+		*target.dest, err = app.optionalDestination(r.Context(), *target.value)
+		if err != nil {
+			app.linkFailedOrServerError(w, r, err)
+			return
+		}
+	}
+	if form.GeoTargets != nil {
+		params.SetGeoTargets = true
+		params.GeoTargets, err = app.geoTargets(r.Context(), *form.GeoTargets)
+		if err != nil {
+			app.linkFailedOrServerError(w, r, err)
+			return
+		}
+	}
+	if form.Variants != nil {
+		params.SetVariants = true
+		params.Variants, err = app.linkVariants(r.Context(), *form.Variants)
+		if err != nil {
+			app.linkFailedOrServerError(w, r, err)
+			return
+		}
+	}
+
+	// only the owner matches the update, anyone else gets a 404
+	dbLink, err := app.queries.UpdateLink(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return
+		}
+		if isCheckViolation(err, "links_window_check") {
+			app.clientError(w, r, fmt.Errorf("not_before must be before not_after"), http.StatusBadRequest)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := helpers.InvalidateLink(r.Context(), app.cache, dbLink.DomainID, urlHash); err != nil {
+		app.logger.Error("failed to invalidate cached link", "hash", urlHash, "err", err)
+	}
+
+	app.writeLink(w, r, dbLink)
+}
+
+func (app *application) deleteLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	urlHash := r.PathValue("hash")
+
+	dbLink, err := app.queries.SoftDeleteLink(r.Context(), database.SoftDeleteLinkParams{
+		Hash:   urlHash,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := helpers.InvalidateLink(r.Context(), app.cache, dbLink.DomainID, urlHash); err != nil {
+		app.logger.Error("failed to invalidate cached link", "hash", urlHash, "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreLinkHandler brings back a deleted link while it's still in the trash
+func (app *application) restoreLinkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	urlHash := r.PathValue("hash")
+
+	dbLink, err := app.queries.RestoreLink(r.Context(), database.RestoreLinkParams{
+		Hash:         urlHash,
+		UserID:       userID,
+		DeletedAfter: time.Now().Add(-app.trashRetention),
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeLink(w, r, dbLink)
+}
+
+// purgeDeletedLinks hard deletes links that stayed in the trash longer than the
+// retention window, and expired anonymous links. Running it on every replica is
+// harmless.
+func (app *application) purgeDeletedLinks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.queries.PurgeDeletedLinks(ctx, time.Now().Add(-app.trashRetention))
+		if err != nil {
+			app.logger.Error("failed to purge deleted links", "err", err)
+		} else if purged > 0 {
+			app.logger.Info("purged deleted links", "count", purged)
+		}
+		app.purgeAnonymousLinks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
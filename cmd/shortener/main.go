@@ -1,17 +1,46 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/redis/go-redis/v9"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"shortening-api/internal/database"
+	"shortening-api/internal/domains"
 	"shortening-api/internal/helpers"
+	"shortening-api/internal/linkpolicy"
+	"shortening-api/internal/shortcode"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTrashRetention = 30 * 24 * time.Hour
+	PurgeInterval         = time.Hour
 )
 
 type application struct {
-	logger  *slog.Logger
-	queries *database.Queries
+	logger          *slog.Logger
+	db              *pgxpool.Pool
+	queries         *database.Queries
+	cache           *redis.Client
+	reservedAliases map[string]struct{}
+	codes           shortcode.Generator
+	canonical       canonicalOptions
+	policy          *linkpolicy.Policy
+	// trashRetention is how long deleted links can be restored before they are purged
+	trashRetention time.Duration
+	// baseURL is the public prefix of links on the default short domain, ending in a slash
+	baseURL string
+	// resolver looks up the TXT records that verify custom domains
+	resolver  domains.Resolver
+	anonymous anonymousOptions
 }
 
 func main() {
@@ -23,18 +52,192 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	reservedAliases, err := helpers.GetEnv("RESERVED_ALIASES")
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 		AddSource: true,
 		Level:     slog.LevelDebug,
 	}))
 
+	sortQuery, err := helpers.GetEnvBool("CANONICAL_SORT_QUERY", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stripTracking, err := helpers.GetEnvBool("CANONICAL_STRIP_TRACKING", false)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	policy, err := newLinkPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	trashRetention := DefaultTrashRetention
+	retention, err := helpers.GetEnv("TRASH_RETENTION")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if retention != "" {
+		trashRetention, err = parseTTL(retention)
+		if err != nil {
+			log.Fatal(fmt.Errorf("invalid TRASH_RETENTION: %w", err))
+		}
+	}
+
+	anonymous, err := newAnonymousOptions()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	baseURL, err := helpers.GetEnv("SHORT_LINK_BASE_URL")
+	if err != nil {
+		log.Fatal(err)
+	}
+	// every link is answered with its full short_url
+	if baseURL == "" {
+		log.Fatal("SHORT_LINK_BASE_URL must be set")
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+
 	queries := database.New(db)
 
+	cache, err := helpers.OpenCache()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	codes, err := newCodeGenerator(queries)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	app := application{
-		logger:  logger,
-		queries: queries,
+		logger:          logger,
+		db:              db,
+		queries:         queries,
+		cache:           cache,
+		reservedAliases: parseReservedAliases(reservedAliases),
+		codes:           codes,
+		canonical: canonicalOptions{
+			sortQuery:     sortQuery,
+			stripTracking: stripTracking,
+		},
+		policy:         policy,
+		trashRetention: trashRetention,
+		baseURL:        baseURL,
+		resolver:       net.DefaultResolver,
+		anonymous:      anonymous,
+	}
+	// imports run inside the process, the ones that were running when it stopped are lost
+	if interrupted, err := queries.FailInterruptedImportJobs(context.Background()); err != nil {
+		log.Fatal(err)
+	} else if interrupted > 0 {
+		app.logger.Warn("marked interrupted imports as failed", "count", interrupted)
 	}
+	go app.purgeDeletedLinks(context.Background(), PurgeInterval)
+
 	app.logger.Info("Auth app is listening on port: " + port)
 	log.Fatal(http.ListenAndServe(":"+port, app.routes()))
 }
+
+// newCodeGenerator builds the short code generator selected by CODE_STRATEGY,
+// CODE_LENGTH and CODE_ALPHABET.
+func newCodeGenerator(queries *database.Queries) (shortcode.Generator, error) {
+	strategy, err := helpers.GetEnv("CODE_STRATEGY")
+	if err != nil {
+		return nil, err
+	}
+	alphabet, err := helpers.GetEnv("CODE_ALPHABET")
+	if err != nil {
+		return nil, err
+	}
+	lengthStr, err := helpers.GetEnv("CODE_LENGTH")
+	if err != nil {
+		return nil, err
+	}
+	length := 0
+	if lengthStr != "" {
+		length, err = strconv.Atoi(lengthStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CODE_LENGTH: %w", err)
+		}
+	}
+
+	return shortcode.New(shortcode.Config{
+		Strategy:    strategy,
+		Length:      length,
+		Alphabet:    alphabet,
+		NextCounter: queries.NextLinkCode,
+	})
+}
+
+// newAnonymousOptions reads the limits of anonymous shortening from
+// ANONYMOUS_LINK_TTL and ANONYMOUS_RATE_LIMIT.
+func newAnonymousOptions() (anonymousOptions, error) {
+	opts := anonymousOptions{linkTTL: DefaultAnonymousLinkTTL, rateLimit: DefaultAnonymousRateLimit}
+
+	ttl, err := helpers.GetEnv("ANONYMOUS_LINK_TTL")
+	if err != nil {
+		return opts, err
+	}
+	if ttl != "" {
+		opts.linkTTL, err = parseTTL(ttl)
+		if err != nil || opts.linkTTL <= 0 {
+			return opts, fmt.Errorf("invalid ANONYMOUS_LINK_TTL %q", ttl)
+		}
+	}
+
+	rateLimit, err := helpers.GetEnv("ANONYMOUS_RATE_LIMIT")
+	if err != nil {
+		return opts, err
+	}
+	if rateLimit != "" {
+		opts.rateLimit, err = strconv.ParseInt(rateLimit, 10, 32)
+		if err != nil || opts.rateLimit < 0 {
+			return opts, fmt.Errorf("invalid ANONYMOUS_RATE_LIMIT %q", rateLimit)
+		}
+	}
+	return opts, nil
+}
+
+// newLinkPolicy builds the destination policy from ALLOWED_SCHEMES,
+// BLOCKLIST_FILE, BLOCK_PRIVATE_ADDRESSES and RESOLVE_HOSTS.
+func newLinkPolicy() (*linkpolicy.Policy, error) {
+	schemes, err := helpers.GetEnv("ALLOWED_SCHEMES")
+	if err != nil {
+		return nil, err
+	}
+	blockPrivate, err := helpers.GetEnvBool("BLOCK_PRIVATE_ADDRESSES", true)
+	if err != nil {
+		return nil, err
+	}
+	resolveHosts, err := helpers.GetEnvBool("RESOLVE_HOSTS", true)
+	if err != nil {
+		return nil, err
+	}
+	blocklistFile, err := helpers.GetEnv("BLOCKLIST_FILE")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := linkpolicy.Config{BlockPrivate: blockPrivate}
+	if schemes != "" {
+		cfg.AllowedSchemes = strings.Split(schemes, ",")
+	}
+	if blocklistFile != "" {
+		cfg.Blocklist, err = linkpolicy.LoadBlocklist(blocklistFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resolveHosts {
+		cfg.Resolver = net.DefaultResolver
+	}
+	return linkpolicy.New(cfg), nil
+}
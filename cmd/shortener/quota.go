@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"net/http"
+	"shortening-api/internal/database"
+	"strconv"
+	"time"
+)
+
+const (
+	CodeQuotaExceeded = "quota_exceeded"
+
+	QuotaMonthlyLinks  = "monthly_links"
+	QuotaActiveLinks   = "active_links"
+	QuotaCustomAliases = "custom_aliases"
+	QuotaAPICalls      = "api_calls"
+
+	// APICallsKeyTTL keeps a day's counter around a little longer than the day
+	APICallsKeyTTL = 48 * time.Hour
+	// PlanCacheTTL is how long metering trusts a cached plan, a changed plan
+	// applies to the api call limit after this long at the latest
+	PlanCacheTTL = 5 * time.Minute
+)
+
+// QuotaExceeded explains which limit of the user's plan a request ran into
+type QuotaExceeded struct {
+	Code    string `json:"code"`
+	Quota   string `json:"quota"`
+	Plan    string `json:"plan"`
+	Limit   int32  `json:"limit"`
+	Message string `json:"error"`
+}
+
+func (e *QuotaExceeded) Error() string {
+	return e.Message
+}
+
+// quota tracks a user's plan limits and usage while links are created. It is
+// loaded after locking the user's row, so concurrent requests of the same user
+// take turns and can't both use the last link of a quota.
+//
+// Imports only count against active links, they bring over links that were
+// created elsewhere and keep their codes without using up custom aliases.
+type quota struct {
+	database.GetUserQuotaRow
+	importing bool
+}
+
+func (app *application) lockQuota(ctx context.Context, q *database.Queries, userID uuid.UUID) (*quota, error) {
+	if err := q.LockUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	row, err := q.GetUserQuota(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &quota{GetUserQuotaRow: row}, nil
+}
+
+// allow checks that the plan has room for one more link. Monthly limits reset,
+// so running out of them is a 429; the others need an upgrade and are a 402.
+func (qt *quota) allow(alias bool) error {
+	if !qt.importing && reached(qt.LinksPerMonth, qt.MonthlyLinksUsed) {
+		return qt.exceeded(http.StatusTooManyRequests, QuotaMonthlyLinks, qt.LinksPerMonth,
+			"monthly link limit reached")
+	}
+	if reached(qt.ActiveLinks, qt.ActiveLinksUsed) {
+		return qt.exceeded(http.StatusPaymentRequired, QuotaActiveLinks, qt.ActiveLinks,
+			"active link limit reached, delete links or upgrade your plan")
+	}
+	if alias && !qt.importing && reached(qt.CustomAliases, qt.CustomAliasesUsed) {
+		return qt.exceeded(http.StatusPaymentRequired, QuotaCustomAliases, qt.CustomAliases,
+			"custom alias limit reached, upgrade your plan")
+	}
+	return nil
+}
+
+// record counts a link that was created
+func (qt *quota) record(alias bool) {
+	qt.ActiveLinksUsed++
+	if qt.importing {
+		return
+	}
+	qt.MonthlyLinksUsed++
+	if alias {
+		qt.CustomAliasesUsed++
+	}
+}
+
+func (qt *quota) exceeded(status int, name string, limit pgtype.Int4, message string) error {
+	return &linkError{status, &QuotaExceeded{
+		Code:    CodeQuotaExceeded,
+		Quota:   name,
+		Plan:    qt.Plan,
+		Limit:   limit.Int32,
+		Message: fmt.Sprintf("%s (%d on the %s plan)", message, limit.Int32, qt.Plan),
+	}}
+}
+
+// setHeaders reports the remaining link quotas. Unlimited quotas are left out.
+func (qt *quota) setHeaders(w http.ResponseWriter) {
+	setQuotaHeaders(w, "Monthly-Links", qt.LinksPerMonth, qt.MonthlyLinksUsed)
+	if qt.LinksPerMonth.Valid {
+		w.Header().Set("X-Quota-Monthly-Links-Reset", strconv.FormatInt(nextMonth(time.Now()).Unix(), 10))
+	}
+	setQuotaHeaders(w, "Active-Links", qt.ActiveLinks, qt.ActiveLinksUsed)
+	setQuotaHeaders(w, "Custom-Aliases", qt.CustomAliases, qt.CustomAliasesUsed)
+}
+
+func setQuotaHeaders(w http.ResponseWriter, name string, limit pgtype.Int4, used int32) {
+	if !limit.Valid {
+		return
+	}
+	w.Header().Set("X-Quota-"+name+"-Limit", strconv.Itoa(int(limit.Int32)))
+	w.Header().Set("X-Quota-"+name+"-Remaining", strconv.Itoa(int(remaining(limit, int64(used)))))
+}
+
+func reached(limit pgtype.Int4, used int32) bool {
+	return limit.Valid && used >= limit.Int32
+}
+
+func remaining(limit pgtype.Int4, used int64) int64 {
+	return max(int64(limit.Int32)-used, 0)
+}
+
+func nextMonth(now time.Time) time.Time {
+	year, month, _ := now.UTC().Date()
+	return time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func nextDay(now time.Time) time.Time {
+	year, month, day := now.UTC().Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+}
+
+func apiCallsKey(userID uuid.UUID, now time.Time) string {
+	return "usage:api:" + userID.String() + ":" + now.UTC().Format(time.DateOnly)
+}
+
+func planCacheKey(userID uuid.UUID) string {
+	return "usage:plan:" + userID.String()
+}
+
+// apiCallPlan is what metering needs to know of a user's plan
+type apiCallPlan struct {
+	Name           string      `json:"name"`
+	ApiCallsPerDay pgtype.Int4 `json:"api_calls_per_day"`
+}
+
+// apiCallPlanOf reads the user's plan from redis, going to the db only when it
+// isn't cached yet, so metering doesn't cost a query on every request.
+func (app *application) apiCallPlanOf(ctx context.Context, userID uuid.UUID) (apiCallPlan, error) {
+	key := planCacheKey(userID)
+	var plan apiCallPlan
+	if cached, err := app.cache.Get(ctx, key).Bytes(); err == nil && json.Unmarshal(cached, &plan) == nil {
+		return plan, nil
+	}
+
+	dbPlan, err := app.queries.GetUserPlan(ctx, userID)
+	if err != nil {
+		return apiCallPlan{}, err
+	}
+	plan = apiCallPlan{Name: dbPlan.Name, ApiCallsPerDay: dbPlan.ApiCallsPerDay}
+	if value, err := json.Marshal(plan); err == nil {
+		if err := app.cache.Set(ctx, key, value, PlanCacheTTL).Err(); err != nil {
+			app.logger.Error("redis failed to cache the plan", "user", userID, "err", err)
+		}
+	}
+	return plan, nil
+}
+
+// meterAPICalls counts every request against the daily API call limit of the
+// user's plan. Counting is best effort: when the plan can't be read or redis is
+// down requests go through.
+func (app *application) meterAPICalls(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := requestUserID(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		plan, err := app.apiCallPlanOf(r.Context(), userID)
+		if err != nil {
+			app.logger.Error("failed to read plan for metering", "user", userID, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !plan.ApiCallsPerDay.Valid {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		key := apiCallsKey(userID, now)
+		pipe := app.cache.TxPipeline()
+		incr := pipe.Incr(r.Context(), key)
+		pipe.Expire(r.Context(), key, APICallsKeyTTL)
+		if _, err := pipe.Exec(r.Context()); err != nil {
+			app.logger.Error("failed to count api call", "user", userID, "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		calls := incr.Val()
+		reset := nextDay(now)
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(int(plan.ApiCallsPerDay.Int32)))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(remaining(plan.ApiCallsPerDay, calls), 10))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		if calls > int64(plan.ApiCallsPerDay.Int32) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			app.writeJSONError(w, r, http.StatusTooManyRequests, &QuotaExceeded{
+				Code:    CodeQuotaExceeded,
+				Quota:   QuotaAPICalls,
+				Plan:    plan.Name,
+				Limit:   plan.ApiCallsPerDay.Int32,
+				Message: fmt.Sprintf("daily api call limit reached (%d on the %s plan)", plan.ApiCallsPerDay.Int32, plan.Name),
+			})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// QuotaUsage is one quota on the usage endpoint. A nil Limit is unlimited.
+type QuotaUsage struct {
+	Used      int64  `json:"used"`
+	Limit     *int32 `json:"limit"`
+	Remaining *int64 `json:"remaining"`
+}
+
+func newQuotaUsage(limit pgtype.Int4, used int64) QuotaUsage {
+	usage := QuotaUsage{Used: used}
+	if limit.Valid {
+		left := remaining(limit, used)
+		usage.Limit = &limit.Int32
+		usage.Remaining = &left
+	}
+	return usage
+}
+
+type UsageResponder struct {
+	Plan                string     `json:"plan"`
+	MonthlyLinks        QuotaUsage `json:"monthly_links"`
+	MonthlyLinksReset   time.Time  `json:"monthly_links_reset"`
+	ActiveLinks         QuotaUsage `json:"active_links"`
+	CustomAliases       QuotaUsage `json:"custom_aliases"`
+	APICalls            QuotaUsage `json:"api_calls_today"`
+	APICallsReset       time.Time  `json:"api_calls_reset"`
+	TotalLinksShortened int32      `json:"total_links_shortened"`
+}
+
+func (app *application) usageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	usage, err := app.queries.GetUserQuota(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	// missing counters just mean no calls today
+	calls, _ := app.cache.Get(r.Context(), apiCallsKey(userID, now)).Int64()
+
+	app.writeJSON(w, r, UsageResponder{
+		Plan:                usage.Plan,
+		MonthlyLinks:        newQuotaUsage(usage.LinksPerMonth, int64(usage.MonthlyLinksUsed)),
+		MonthlyLinksReset:   nextMonth(now),
+		ActiveLinks:         newQuotaUsage(usage.ActiveLinks, int64(usage.ActiveLinksUsed)),
+		CustomAliases:       newQuotaUsage(usage.CustomAliases, int64(usage.CustomAliasesUsed)),
+		APICalls:            newQuotaUsage(usage.ApiCallsPerDay, calls),
+		APICallsReset:       nextDay(now),
+		TotalLinksShortened: usage.TotalUrlShortened,
+	})
+}
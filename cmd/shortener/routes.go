@@ -7,9 +7,41 @@ import (
 
 func (app *application) routes() http.Handler {
 	mux := http.NewServeMux()
-	standard := alice.New(app.recoverPanic, app.logRequest)
+	standard := alice.New(app.recoverPanic, app.logRequest, app.meterAPICalls)
 
-	mux.HandleFunc("POST /", app.shortenerHandler)
+	mux.Handle("POST /{$}", app.idempotent(http.HandlerFunc(app.shortenerHandler)))
+	mux.Handle("POST /bulk", app.idempotent(http.HandlerFunc(app.bulkShortenHandler)))
+	mux.HandleFunc("GET /{$}", app.listLinksHandler)
+	mux.HandleFunc("GET /{hash}", app.getLinkHandler)
+	mux.HandleFunc("PATCH /{hash}", app.updateLinkHandler)
+	mux.HandleFunc("DELETE /{hash}", app.deleteLinkHandler)
+	mux.HandleFunc("POST /{hash}/restore", app.restoreLinkHandler)
+	mux.HandleFunc("POST /links/tags", app.retagLinksHandler)
+	mux.HandleFunc("POST /links/move", app.moveLinksHandler)
+	mux.HandleFunc("GET /links/{hash}/variants", app.variantStatsHandler)
+	mux.HandleFunc("POST /claim", app.claimLinksHandler)
+
+	mux.HandleFunc("GET /usage", app.usageHandler)
+
+	mux.HandleFunc("GET /export", app.exportLinksHandler)
+	mux.HandleFunc("GET /imports", app.listImportsHandler)
+	mux.HandleFunc("POST /imports", app.importLinksHandler)
+	mux.HandleFunc("GET /imports/{id}", app.getImportHandler)
+
+	mux.HandleFunc("GET /tags", app.listTagsHandler)
+	mux.HandleFunc("POST /tags", app.createTagHandler)
+	mux.HandleFunc("PATCH /tags/{id}", app.renameTagHandler)
+	mux.HandleFunc("DELETE /tags/{id}", app.deleteTagHandler)
+
+	mux.HandleFunc("GET /domains", app.listDomainsHandler)
+	mux.HandleFunc("POST /domains", app.createDomainHandler)
+	mux.HandleFunc("POST /domains/{id}/verify", app.verifyDomainHandler)
+	mux.HandleFunc("DELETE /domains/{id}", app.deleteDomainHandler)
+
+	mux.HandleFunc("GET /folders", app.listFoldersHandler)
+	mux.HandleFunc("POST /folders", app.createFolderHandler)
+	mux.HandleFunc("PATCH /folders/{id}", app.renameFolderHandler)
+	mux.HandleFunc("DELETE /folders/{id}", app.deleteFolderHandler)
 
 	return standard.Then(mux)
 }
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jackc/pgx/v5/pgtype"
+	"shortening-api/internal/database"
+	"shortening-api/internal/schedule"
+	"strings"
+	"time"
+)
+
+const DefaultScheduleTimezone = "UTC"
+
+// LinkSchedule opens a link between Start and End ("15:04") on Days, in the
+// wall clock of Timezone. Days take names such as "mon" and ranges such as
+// "mon-fri" and default to every day.
+type LinkSchedule struct {
+	Days     []string `form:"days" json:"days"`
+	Start    string   `form:"start" json:"start"`
+	End      string   `form:"end" json:"end"`
+	Timezone string   `form:"timezone" json:"timezone"`
+}
+
+func (s *LinkSchedule) empty() bool {
+	return len(s.Days) == 0 && s.Start == "" && s.End == "" && s.Timezone == ""
+}
+
+// scheduleColumns is a recurring schedule the way links store it
+type scheduleColumns struct {
+	days       pgtype.Int2
+	start, end pgtype.Time
+	timezone   pgtype.Text
+}
+
+// parseSchedule validates a submitted schedule. A missing or empty schedule
+// gives all NULL columns.
+func parseSchedule(form *LinkSchedule) (scheduleColumns, error) {
+	var cols scheduleColumns
+	if form == nil || form.empty() {
+		return cols, nil
+	}
+	if form.Start == "" || form.End == "" {
+		return cols, fmt.Errorf("schedule needs a start and an end")
+	}
+
+	days, err := schedule.ParseDays(form.Days)
+	if err != nil {
+		return cols, fmt.Errorf("schedule: %w", err)
+	}
+	start, err := schedule.ParseClock(form.Start)
+	if err != nil {
+		return cols, fmt.Errorf("schedule start: %w", err)
+	}
+	end, err := schedule.ParseClock(form.End)
+	if err != nil {
+		return cols, fmt.Errorf("schedule end: %w", err)
+	}
+	timezone := strings.TrimSpace(form.Timezone)
+	if timezone == "" {
+		timezone = DefaultScheduleTimezone
+	}
+	if _, err := time.LoadLocation(timezone); err != nil {
+		return cols, fmt.Errorf("unknown time zone %q", timezone)
+	}
+
+	cols.days = pgtype.Int2{Int16: int16(days), Valid: true}
+	cols.start = pgtype.Time{Microseconds: start.Microseconds(), Valid: true}
+	cols.end = pgtype.Time{Microseconds: end.Microseconds(), Valid: true}
+	cols.timezone = pgtype.Text{String: timezone, Valid: true}
+	return cols, nil
+}
+
+// scheduleOf is the inverse of parseSchedule for responses
+func scheduleOf(dbLink database.Link) *LinkSchedule {
+	if !dbLink.ScheduleDays.Valid {
+		return nil
+	}
+	return &LinkSchedule{
+		Days:     schedule.FormatDays(int(dbLink.ScheduleDays.Int16)),
+		Start:    schedule.FormatClock(time.Duration(dbLink.ScheduleStart.Microseconds) * time.Microsecond),
+		End:      schedule.FormatClock(time.Duration(dbLink.ScheduleEnd.Microseconds) * time.Microsecond),
+		Timezone: dbLink.ScheduleTz.String,
+	}
+}
+
+// parseWindowBound reads not_before and not_after, which take the same values
+// as expires_at. An empty value leaves the bound open.
+func parseWindowBound(field, value string, now time.Time) (pgtype.Timestamptz, error) {
+	if value == "" {
+		return pgtype.Timestamptz{}, nil
+	}
+	t, err := parseFutureTime(field, value, now)
+	if err != nil {
+		return pgtype.Timestamptz{}, err
+	}
+	return pgtype.Timestamptz{Time: t, Valid: true}, nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/helpers"
+	"strings"
+	"time"
+)
+
+const (
+	MaxTagChars  = 50
+	MaxLinkTags  = 20
+	MaxSelection = MaxBulkRows
+)
+
+type TagResponder struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NameForm creates or renames a tag or a folder
+type NameForm struct {
+	Name string `form:"name" json:"name"`
+}
+
+func (app *application) listTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	tags, err := app.queries.ListTags(r.Context(), userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	resp := make([]TagResponder, 0, len(tags))
+	for _, tag := range tags {
+		resp = append(resp, TagResponder{tag.ID, tag.Name, tag.CreatedAt})
+	}
+	app.writeJSON(w, r, resp)
+}
+
+func (app *application) createTagHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var form NameForm
+	if err := helpers.DecodeRequest(w, r, &form); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	name, err := validateName("tag", form.Name, MaxTagChars)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	tag, err := app.queries.CreateTag(r.Context(), database.CreateTagParams{UserID: userID, Name: name})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, TagResponder{tag.ID, tag.Name, tag.CreatedAt})
+}
+
+func (app *application) renameTagHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	tagID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	var form NameForm
+	if err := helpers.DecodeRequest(w, r, &form); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	name, err := validateName("tag", form.Name, MaxTagChars)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+
+	tag, err := app.queries.RenameTag(r.Context(), database.RenameTagParams{
+		Name:   name,
+		ID:     tagID,
+		UserID: userID,
+	})
+	if err != nil {
+		app.nameConflictOrServerError(w, r, err)
+		return
+	}
+	app.writeJSON(w, r, TagResponder{tag.ID, tag.Name, tag.CreatedAt})
+}
+
+// deleteTagHandler removes the tag from every link it was on
+func (app *application) deleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	tagID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+
+	deleted, err := app.queries.DeleteTag(r.Context(), database.DeleteTagParams{ID: tagID, UserID: userID})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if deleted == 0 {
+		app.clientError(w, r, fmt.Errorf("tag %s not found", tagID), http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RetagForm adds and removes tags on a selection of links. Tags that don't
+// exist yet are created.
+type RetagForm struct {
+	Hashes []string `json:"hashes"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+type RetagResponder struct {
+	Tagged   int64 `json:"tagged"`
+	Untagged int64 `json:"untagged"`
+}
+
+func (app *application) retagLinksHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	var form RetagForm
+	if err := helpers.DecodeJSON(w, r, &form, helpers.MaxJSONBodyBytes); err != nil {
+		app.decodeError(w, r, err)
+		return
+	}
+	if err := validateSelection(form.Hashes); err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	add, err := normalizeTags(form.Add)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	remove, err := normalizeTags(form.Remove)
+	if err != nil {
+		app.clientError(w, r, err, http.StatusBadRequest)
+		return
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		app.clientError(w, r, fmt.Errorf("nothing to update"), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := app.db.Begin(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	defer tx.Rollback(r.Context())
+	qtx := app.queries.WithTx(tx)
+
+	var resp RetagResponder
+	if len(remove) > 0 {
+		resp.Untagged, err = qtx.UntagLinks(r.Context(), database.UntagLinksParams{
+			UserID: userID,
+			Hashes: form.Hashes,
+			Names:  remove,
+		})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if len(add) > 0 {
+		resp.Tagged, err = tagLinks(r.Context(), qtx, userID, form.Hashes, add)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, r, resp)
+}
+
+// tagLinks puts the named tags on the user's links, creating missing tags.
+// Links that already carry a tag are left alone.
+func tagLinks(ctx context.Context, q *database.Queries, userID uuid.UUID, hashes, names []string) (int64, error) {
+	tags, err := q.UpsertTags(ctx, database.UpsertTagsParams{UserID: userID, Names: names})
+	if err != nil {
+		return 0, err
+	}
+	tagIDs := make([]uuid.UUID, 0, len(tags))
+	for _, tag := range tags {
+		tagIDs = append(tagIDs, tag.ID)
+	}
+	return q.TagLinks(ctx, database.TagLinksParams{
+		UserID: userID,
+		Hashes: hashes,
+		TagIds: tagIDs,
+	})
+}
+
+// normalizeTags trims tag names and drops empty and repeated ones
+func normalizeTags(names []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(names))
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		if !MaxChars(name, MaxTagChars) {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", name, MaxTagChars)
+		}
+		seen[name] = struct{}{}
+		tags = append(tags, name)
+	}
+	if len(tags) > MaxLinkTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", MaxLinkTags)
+	}
+	return tags, nil
+}
+
+func validateName(kind, name string, maxChars int) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("%s name must not be empty", kind)
+	}
+	if !MaxChars(name, maxChars) {
+		return "", fmt.Errorf("%s name must not be longer than %d characters", kind, maxChars)
+	}
+	return name, nil
+}
+
+func validateSelection(hashes []string) error {
+	if len(hashes) == 0 {
+		return fmt.Errorf("no links selected")
+	}
+	if len(hashes) > MaxSelection {
+		return fmt.Errorf("at most %d links can be selected at once", MaxSelection)
+	}
+	return nil
+}
+
+// nameConflictOrServerError answers failed tag and folder writes. Names are
+// unique per user and missing rows belong to someone else.
+func (app *application) nameConflictOrServerError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		app.clientError(w, r, err, http.StatusNotFound)
+		return
+	}
+	if isCollision(err) {
+		app.clientError(w, r, err, http.StatusConflict)
+		return
+	}
+	app.serverError(w, r, err)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	LinkPasswordMinChars = 8
+	// LinkPasswordMaxBytes is the most bcrypt will hash
+	LinkPasswordMaxBytes = 72
+	// LinkPasswordCost matches the cost used for user passwords
+	LinkPasswordCost = bcrypt.DefaultCost + 2
+
+	AliasMinChars = 3
+	// AliasMaxChars matches the size of the links.hash column
+	AliasMaxChars = 20
+
+	// MaxTTLDays keeps "d" durations well inside what time.Duration can hold
+	MaxTTLDays = 36500
+)
+
+var AliasRX = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+var defaultReservedAliases = []string{"api", "auth", "admin", "shorten", "redirect", "login", "logout", "signup", "refresh", "public.pem", "tags", "folders", "links", "usage", "export", "imports", "domains", "claim"}
+
+func Blank(value string) bool {
+	return strings.TrimSpace(value) == ""
+}
+
+func MaxChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) <= n
+}
+
+func MinChars(value string, n int) bool {
+	return utf8.RuneCountInString(value) >= n
+}
+
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+// parseReservedAliases turns a comma separated list into a lookup set,
+// falling back to the default list when the value is blank.
+func parseReservedAliases(value string) map[string]struct{} {
+	words := defaultReservedAliases
+	if !Blank(value) {
+		words = strings.Split(value, ",")
+	}
+
+	reserved := make(map[string]struct{}, len(words))
+	for _, word := range words {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" {
+			reserved[word] = struct{}{}
+		}
+	}
+	return reserved
+}
+
+func (app *application) validateAlias(alias string) error {
+	if !MinChars(alias, AliasMinChars) || !MaxChars(alias, AliasMaxChars) {
+		return fmt.Errorf("alias must be between %d and %d characters", AliasMinChars, AliasMaxChars)
+	}
+	if !Matches(alias, AliasRX) {
+		return fmt.Errorf("alias may only contain letters, digits, '-' and '_'")
+	}
+	if _, ok := app.reservedAliases[strings.ToLower(alias)]; ok {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	return nil
+}
+
+// parseExpiry accepts either an absolute RFC 3339 time or a TTL relative to now,
+// such as "90m", "12h" or "7d".
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	return parseFutureTime("expires_at", value, now)
+}
+
+// parseFutureTime reads an RFC 3339 time or a TTL counted from now into a point
+// in time that must lie in the future. field names the value in errors.
+func parseFutureTime(field, value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("%s must be in the future", field)
+		}
+		return t, nil
+	}
+
+	ttl, err := parseTTL(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q", field, value)
+	}
+	if ttl <= 0 {
+		return time.Time{}, fmt.Errorf("%s must be in the future", field)
+	}
+	return now.Add(ttl), nil
+}
+
+// parseTTL is time.ParseDuration with an extra "d" unit for days
+func parseTTL(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		if n <= 0 || n > MaxTTLDays {
+			return 0, fmt.Errorf("days must be between 1 and %d", MaxTTLDays)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
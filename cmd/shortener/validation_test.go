@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTTL(t *testing.T) {
+	valid := map[string]time.Duration{
+		"90m":    90 * time.Minute,
+		"12h":    12 * time.Hour,
+		"7d":     7 * 24 * time.Hour,
+		"36500d": MaxTTLDays * 24 * time.Hour,
+	}
+	for value, want := range valid {
+		if got, err := parseTTL(value); err != nil || got != want {
+			t.Errorf("parseTTL(%q) = %s, %v, want %s", value, got, err, want)
+		}
+	}
+
+	for _, value := range []string{"0d", "-1d", "36501d", "200000d", "9223372036854775807d", "d", "soon"} {
+		if got, err := parseTTL(value); err == nil {
+			t.Errorf("parseTTL(%q) = %s, want an error", value, got)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2025, 6, 16, 12, 0, 0, 0, time.UTC)
+	if got, err := parseExpiry("7d", now); err != nil || !got.Equal(now.Add(7*24*time.Hour)) {
+		t.Errorf("parseExpiry(7d) = %s, %v", got, err)
+	}
+	for _, value := range []string{"2025-06-16T11:00:00Z", "-1h", "200000d"} {
+		if _, err := parseExpiry(value, now); err == nil {
+			t.Errorf("parseExpiry(%q) accepted a time that isn't in the future", value)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"shortening-api/internal/database"
+	"shortening-api/internal/variants"
+)
+
+// VariantStatsResponder is how often one variant of a split link was served
+type VariantStatsResponder struct {
+	Name   string `json:"name"`
+	Link   string `json:"link"`
+	Weight int    `json:"weight"`
+	Served int64  `json:"served"`
+}
+
+// variantStatsHandler reports how often each current variant of one of the
+// caller's links was served, so that conversions on the destinations can be
+// compared per variant. Variants that were removed from the link are left out,
+// and the redirect service adds visits to the counts every few seconds.
+func (app *application) variantStatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := requestUserID(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	urlHash := r.PathValue("hash")
+
+	dbLink, err := app.queries.GetUserLink(r.Context(), database.GetUserLinkParams{
+		Hash:   urlHash,
+		UserID: userID,
+	})
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			app.clientError(w, r, err, http.StatusNotFound)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	if dbLink.DeletedAt.Valid {
+		app.clientError(w, r, fmt.Errorf("link %s not found", urlHash), http.StatusNotFound)
+		return
+	}
+	linkVariants, err := variants.Decode(dbLink.Variants)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	stats, err := app.queries.ListVariantStats(r.Context(), database.ListVariantStatsParams{
+		UserID: userID,
+		Hash:   urlHash,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	served := make(map[string]int64, len(stats))
+	for _, stat := range stats {
+		served[stat.Variant] = stat.Served
+	}
+
+	resps := make([]VariantStatsResponder, 0, len(linkVariants))
+	for _, variant := range linkVariants {
+		resps = append(resps, VariantStatsResponder{
+			Name:   variant.Name,
+			Link:   variant.Link,
+			Weight: variant.Weight,
+			Served: served[variant.Name],
+		})
+	}
+	app.writeJSON(w, r, resps)
+}
@@ -7,48 +7,539 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-const getLink = `-- name: GetLink :one
-SELECT hash, user_id, link, created_at FROM links
-WHERE hash = $1 LIMIT 1
+const consumeLinkVisit = `-- name: ConsumeLinkVisit :one
+UPDATE links
+SET visit_count = visit_count + 1
+WHERE hash = $1 AND domain_id IS NOT DISTINCT FROM $2::uuid
+  AND deleted_at IS NULL AND (max_visits IS NULL OR visit_count < max_visits)
+RETURNING visit_count
 `
 
-func (q *Queries) GetLink(ctx context.Context, hash string) (Link, error) {
-	row := q.db.QueryRow(ctx, getLink, hash)
+type ConsumeLinkVisitParams struct {
+	Hash     string
+	DomainID pgtype.UUID
+}
+
+func (q *Queries) ConsumeLinkVisit(ctx context.Context, arg ConsumeLinkVisitParams) (int32, error) {
+	row := q.db.QueryRow(ctx, consumeLinkVisit, arg.Hash, arg.DomainID)
+	var visit_count int32
+	err := row.Scan(&visit_count)
+	return visit_count, err
+}
+
+const getDomainLink = `-- name: GetDomainLink :one
+SELECT hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants FROM links
+WHERE hash = $1 AND domain_id IS NOT DISTINCT FROM $2::uuid
+`
+
+type GetDomainLinkParams struct {
+	Hash     string
+	DomainID pgtype.UUID
+}
+
+func (q *Queries) GetDomainLink(ctx context.Context, arg GetDomainLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, getDomainLink, arg.Hash, arg.DomainID)
 	var i Link
 	err := row.Scan(
 		&i.Hash,
 		&i.UserID,
 		&i.Link,
 		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.CanonicalLink,
+		&i.PasswordHash,
+		&i.MaxVisits,
+		&i.VisitCount,
+		&i.Title,
+		&i.DeletedAt,
+		&i.Domain,
+		&i.FolderID,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.ScheduleDays,
+		&i.ScheduleStart,
+		&i.ScheduleEnd,
+		&i.ScheduleTz,
+		&i.FallbackUrl,
+		&i.CustomAlias,
+		&i.DomainID,
+		&i.IosLink,
+		&i.AndroidLink,
+		&i.GeoTargets,
+		&i.Variants,
+	)
+	return i, err
+}
+
+const getUserLink = `-- name: GetUserLink :one
+SELECT hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants FROM links
+WHERE hash = $1 AND user_id = $2
+`
+
+type GetUserLinkParams struct {
+	Hash   string
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetUserLink(ctx context.Context, arg GetUserLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, getUserLink, arg.Hash, arg.UserID)
+	var i Link
+	err := row.Scan(
+		&i.Hash,
+		&i.UserID,
+		&i.Link,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.CanonicalLink,
+		&i.PasswordHash,
+		&i.MaxVisits,
+		&i.VisitCount,
+		&i.Title,
+		&i.DeletedAt,
+		&i.Domain,
+		&i.FolderID,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.ScheduleDays,
+		&i.ScheduleStart,
+		&i.ScheduleEnd,
+		&i.ScheduleTz,
+		&i.FallbackUrl,
+		&i.CustomAlias,
+		&i.DomainID,
+		&i.IosLink,
+		&i.AndroidLink,
+		&i.GeoTargets,
+		&i.Variants,
 	)
 	return i, err
 }
 
 const insertLink = `-- name: InsertLink :one
-INSERT INTO links(hash, user_id, link)
-VALUES ($1, $2, $3)
-RETURNING hash, user_id, link, created_at
+INSERT INTO links(hash, user_id, link, expires_at, canonical_link, password_hash, max_visits, title, domain, folder_id,
+                  not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias,
+                  domain_id, ios_link, android_link, geo_targets, variants)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
+ON CONFLICT DO NOTHING
+RETURNING hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants
 `
 
 type InsertLinkParams struct {
+	Hash          string
+	UserID        uuid.UUID
+	Link          pgtype.Text
+	ExpiresAt     pgtype.Timestamptz
+	CanonicalLink pgtype.Text
+	PasswordHash  pgtype.Text
+	MaxVisits     pgtype.Int4
+	Title         pgtype.Text
+	Domain        pgtype.Text
+	FolderID      pgtype.UUID
+	NotBefore     pgtype.Timestamptz
+	NotAfter      pgtype.Timestamptz
+	ScheduleDays  pgtype.Int2
+	ScheduleStart pgtype.Time
+	ScheduleEnd   pgtype.Time
+	ScheduleTz    pgtype.Text
+	FallbackUrl   pgtype.Text
+	CustomAlias   bool
+	DomainID      pgtype.UUID
+	IosLink       pgtype.Text
+	AndroidLink   pgtype.Text
+	GeoTargets    []byte
+	Variants      []byte
+}
+
+// a taken code conflicts on the short domain or on the user, either way no row is returned
+func (q *Queries) InsertLink(ctx context.Context, arg InsertLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, insertLink,
+		arg.Hash,
+		arg.UserID,
+		arg.Link,
+		arg.ExpiresAt,
+		arg.CanonicalLink,
+		arg.PasswordHash,
+		arg.MaxVisits,
+		arg.Title,
+		arg.Domain,
+		arg.FolderID,
+		arg.NotBefore,
+		arg.NotAfter,
+		arg.ScheduleDays,
+		arg.ScheduleStart,
+		arg.ScheduleEnd,
+		arg.ScheduleTz,
+		arg.FallbackUrl,
+		arg.CustomAlias,
+		arg.DomainID,
+		arg.IosLink,
+		arg.AndroidLink,
+		arg.GeoTargets,
+		arg.Variants,
+	)
+	var i Link
+	err := row.Scan(
+		&i.Hash,
+		&i.UserID,
+		&i.Link,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.CanonicalLink,
+		&i.PasswordHash,
+		&i.MaxVisits,
+		&i.VisitCount,
+		&i.Title,
+		&i.DeletedAt,
+		&i.Domain,
+		&i.FolderID,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.ScheduleDays,
+		&i.ScheduleStart,
+		&i.ScheduleEnd,
+		&i.ScheduleTz,
+		&i.FallbackUrl,
+		&i.CustomAlias,
+		&i.DomainID,
+		&i.IosLink,
+		&i.AndroidLink,
+		&i.GeoTargets,
+		&i.Variants,
+	)
+	return i, err
+}
+
+const listUserLinks = `-- name: ListUserLinks :many
+SELECT hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants FROM links
+WHERE user_id = $1
+  AND deleted_at IS NULL
+  AND ($2::timestamptz IS NULL
+       OR (created_at, hash) < ($2::timestamptz, $3::text))
+  AND ($4::timestamptz IS NULL OR created_at >= $4::timestamptz)
+  AND ($5::timestamptz IS NULL OR created_at < $5::timestamptz)
+  AND ($6::text IS NULL OR domain = $6::text OR right(domain, length($6::text) + 1) = '.' || $6::text)
+  AND ($7::text IS NULL
+       OR ($7::text = 'active'
+           AND (expires_at IS NULL OR expires_at > NOW())
+           AND (max_visits IS NULL OR visit_count < max_visits))
+       OR ($7::text = 'expired'
+           AND (expires_at <= NOW() OR visit_count >= max_visits)))
+  AND ($8::uuid IS NULL OR folder_id = $8::uuid)
+  AND ($9::text IS NULL OR EXISTS (
+       SELECT 1 FROM link_tags JOIN tags ON tags.id = link_tags.tag_id
+       WHERE link_tags.user_id = links.user_id AND link_tags.link_hash = links.hash AND tags.name = $9::text))
+  AND ($10::text IS NULL
+       OR to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(link, '')) @@ websearch_to_tsquery('simple', $10::text))
+ORDER BY created_at DESC, hash DESC
+LIMIT $11
+`
+
+type ListUserLinksParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt pgtype.Timestamptz
+	CursorHash      pgtype.Text
+	CreatedAfter    pgtype.Timestamptz
+	CreatedBefore   pgtype.Timestamptz
+	Domain          pgtype.Text
+	Status          pgtype.Text
+	FolderID        pgtype.UUID
+	Tag             pgtype.Text
+	Query           pgtype.Text
+	PageSize        int32
+}
+
+func (q *Queries) ListUserLinks(ctx context.Context, arg ListUserLinksParams) ([]Link, error) {
+	rows, err := q.db.Query(ctx, listUserLinks,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorHash,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.Domain,
+		arg.Status,
+		arg.FolderID,
+		arg.Tag,
+		arg.Query,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Link
+	for rows.Next() {
+		var i Link
+		if err := rows.Scan(
+			&i.Hash,
+			&i.UserID,
+			&i.Link,
+			&i.CreatedAt,
+			&i.ExpiresAt,
+			&i.CanonicalLink,
+			&i.PasswordHash,
+			&i.MaxVisits,
+			&i.VisitCount,
+			&i.Title,
+			&i.DeletedAt,
+			&i.Domain,
+			&i.FolderID,
+			&i.NotBefore,
+			&i.NotAfter,
+			&i.ScheduleDays,
+			&i.ScheduleStart,
+			&i.ScheduleEnd,
+			&i.ScheduleTz,
+			&i.FallbackUrl,
+			&i.CustomAlias,
+			&i.DomainID,
+			&i.IosLink,
+			&i.AndroidLink,
+			&i.GeoTargets,
+			&i.Variants,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const nextLinkCode = `-- name: NextLinkCode :one
+SELECT nextval('link_code_seq')::bigint
+`
+
+func (q *Queries) NextLinkCode(ctx context.Context) (int64, error) {
+	row := q.db.QueryRow(ctx, nextLinkCode)
+	var column_1 int64
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const purgeDeletedLinks = `-- name: PurgeDeletedLinks :execrows
+DELETE FROM links
+WHERE deleted_at < $1::timestamptz
+`
+
+func (q *Queries) PurgeDeletedLinks(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeDeletedLinks, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreLink = `-- name: RestoreLink :one
+UPDATE links
+SET deleted_at = NULL
+WHERE hash = $1 AND user_id = $2 AND deleted_at > $3::timestamptz
+RETURNING hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants
+`
+
+type RestoreLinkParams struct {
+	Hash         string
+	UserID       uuid.UUID
+	DeletedAfter time.Time
+}
+
+func (q *Queries) RestoreLink(ctx context.Context, arg RestoreLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, restoreLink, arg.Hash, arg.UserID, arg.DeletedAfter)
+	var i Link
+	err := row.Scan(
+		&i.Hash,
+		&i.UserID,
+		&i.Link,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.CanonicalLink,
+		&i.PasswordHash,
+		&i.MaxVisits,
+		&i.VisitCount,
+		&i.Title,
+		&i.DeletedAt,
+		&i.Domain,
+		&i.FolderID,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.ScheduleDays,
+		&i.ScheduleStart,
+		&i.ScheduleEnd,
+		&i.ScheduleTz,
+		&i.FallbackUrl,
+		&i.CustomAlias,
+		&i.DomainID,
+		&i.IosLink,
+		&i.AndroidLink,
+		&i.GeoTargets,
+		&i.Variants,
+	)
+	return i, err
+}
+
+const softDeleteLink = `-- name: SoftDeleteLink :one
+UPDATE links
+SET deleted_at = NOW()
+WHERE hash = $1 AND user_id = $2 AND deleted_at IS NULL
+RETURNING hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants
+`
+
+type SoftDeleteLinkParams struct {
 	Hash   string
 	UserID uuid.UUID
-	Link   pgtype.Text
 }
 
-func (q *Queries) InsertLink(ctx context.Context, arg InsertLinkParams) (Link, error) {
-	row := q.db.QueryRow(ctx, insertLink, arg.Hash, arg.UserID, arg.Link)
+func (q *Queries) SoftDeleteLink(ctx context.Context, arg SoftDeleteLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, softDeleteLink, arg.Hash, arg.UserID)
+	var i Link
+	err := row.Scan(
+		&i.Hash,
+		&i.UserID,
+		&i.Link,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.CanonicalLink,
+		&i.PasswordHash,
+		&i.MaxVisits,
+		&i.VisitCount,
+		&i.Title,
+		&i.DeletedAt,
+		&i.Domain,
+		&i.FolderID,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.ScheduleDays,
+		&i.ScheduleStart,
+		&i.ScheduleEnd,
+		&i.ScheduleTz,
+		&i.FallbackUrl,
+		&i.CustomAlias,
+		&i.DomainID,
+		&i.IosLink,
+		&i.AndroidLink,
+		&i.GeoTargets,
+		&i.Variants,
+	)
+	return i, err
+}
+
+const updateLink = `-- name: UpdateLink :one
+UPDATE links
+SET link = COALESCE($1, link),
+    canonical_link = COALESCE($2, canonical_link),
+    domain = COALESCE($3, domain),
+    expires_at = CASE WHEN $4::boolean THEN $5 ELSE expires_at END,
+    not_before = CASE WHEN $6::boolean THEN $7 ELSE not_before END,
+    not_after = CASE WHEN $8::boolean THEN $9 ELSE not_after END,
+    schedule_days = CASE WHEN $10::boolean THEN $11 ELSE schedule_days END,
+    schedule_start = CASE WHEN $10::boolean THEN $12 ELSE schedule_start END,
+    schedule_end = CASE WHEN $10::boolean THEN $13 ELSE schedule_end END,
+    schedule_tz = CASE WHEN $10::boolean THEN $14 ELSE schedule_tz END,
+    fallback_url = CASE WHEN $15::boolean THEN $16 ELSE fallback_url END,
+    ios_link = CASE WHEN $17::boolean THEN $18 ELSE ios_link END,
+    android_link = CASE WHEN $19::boolean THEN $20 ELSE android_link END,
+    geo_targets = CASE WHEN $21::boolean THEN $22 ELSE geo_targets END,
+    variants = CASE WHEN $23::boolean THEN $24 ELSE variants END,
+    title = COALESCE($25, title)
+WHERE hash = $26 AND user_id = $27 AND deleted_at IS NULL
+RETURNING hash, user_id, link, created_at, expires_at, canonical_link, password_hash, max_visits, visit_count, title, deleted_at, domain, folder_id, not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias, domain_id, ios_link, android_link, geo_targets, variants
+`
+
+type UpdateLinkParams struct {
+	Link           pgtype.Text
+	CanonicalLink  pgtype.Text
+	Domain         pgtype.Text
+	SetExpiresAt   bool
+	ExpiresAt      pgtype.Timestamptz
+	SetNotBefore   bool
+	NotBefore      pgtype.Timestamptz
+	SetNotAfter    bool
+	NotAfter       pgtype.Timestamptz
+	SetSchedule    bool
+	ScheduleDays   pgtype.Int2
+	ScheduleStart  pgtype.Time
+	ScheduleEnd    pgtype.Time
+	ScheduleTz     pgtype.Text
+	SetFallbackUrl bool
+	FallbackUrl    pgtype.Text
+	SetIosLink     bool
+	IosLink        pgtype.Text
+	SetAndroidLink bool
+	AndroidLink    pgtype.Text
+	SetGeoTargets  bool
+	GeoTargets     []byte
+	SetVariants    bool
+	Variants       []byte
+	Title          pgtype.Text
+	Hash           string
+	UserID         uuid.UUID
+}
+
+func (q *Queries) UpdateLink(ctx context.Context, arg UpdateLinkParams) (Link, error) {
+	row := q.db.QueryRow(ctx, updateLink,
+		arg.Link,
+		arg.CanonicalLink,
+		arg.Domain,
+		arg.SetExpiresAt,
+		arg.ExpiresAt,
+		arg.SetNotBefore,
+		arg.NotBefore,
+		arg.SetNotAfter,
+		arg.NotAfter,
+		arg.SetSchedule,
+		arg.ScheduleDays,
+		arg.ScheduleStart,
+		arg.ScheduleEnd,
+		arg.ScheduleTz,
+		arg.SetFallbackUrl,
+		arg.FallbackUrl,
+		arg.SetIosLink,
+		arg.IosLink,
+		arg.SetAndroidLink,
+		arg.AndroidLink,
+		arg.SetGeoTargets,
+		arg.GeoTargets,
+		arg.SetVariants,
+		arg.Variants,
+		arg.Title,
+		arg.Hash,
+		arg.UserID,
+	)
 	var i Link
 	err := row.Scan(
 		&i.Hash,
 		&i.UserID,
 		&i.Link,
 		&i.CreatedAt,
+		&i.ExpiresAt,
+		&i.CanonicalLink,
+		&i.PasswordHash,
+		&i.MaxVisits,
+		&i.VisitCount,
+		&i.Title,
+		&i.DeletedAt,
+		&i.Domain,
+		&i.FolderID,
+		&i.NotBefore,
+		&i.NotAfter,
+		&i.ScheduleDays,
+		&i.ScheduleStart,
+		&i.ScheduleEnd,
+		&i.ScheduleTz,
+		&i.FallbackUrl,
+		&i.CustomAlias,
+		&i.DomainID,
+		&i.IosLink,
+		&i.AndroidLink,
+		&i.GeoTargets,
+		&i.Variants,
 	)
 	return i, err
 }
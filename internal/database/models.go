@@ -11,13 +11,101 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type Link struct {
-	Hash      string
+type AnonymousLink struct {
+	UserID      uuid.UUID
+	Hash        string
+	SessionHash string
+	CreatedAt   time.Time
+}
+
+type CustomDomain struct {
+	ID                uuid.UUID
+	UserID            uuid.UUID
+	Hostname          string
+	VerificationToken string
+	VerifiedAt        pgtype.Timestamptz
+	CreatedAt         time.Time
+}
+
+type Folder struct {
+	ID        uuid.UUID
 	UserID    uuid.UUID
-	Link      pgtype.Text
+	Name      string
 	CreatedAt time.Time
 }
 
+type ImportJob struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Source     string
+	Status     string
+	Total      int32
+	Processed  int32
+	Created    int32
+	Conflicts  int32
+	Failed     int32
+	Problems   []byte
+	Error      pgtype.Text
+	CreatedAt  time.Time
+	FinishedAt pgtype.Timestamptz
+}
+
+type Link struct {
+	Hash          string
+	UserID        uuid.UUID
+	Link          pgtype.Text
+	CreatedAt     time.Time
+	ExpiresAt     pgtype.Timestamptz
+	CanonicalLink pgtype.Text
+	PasswordHash  pgtype.Text
+	MaxVisits     pgtype.Int4
+	VisitCount    int32
+	Title         pgtype.Text
+	DeletedAt     pgtype.Timestamptz
+	Domain        pgtype.Text
+	FolderID      pgtype.UUID
+	NotBefore     pgtype.Timestamptz
+	NotAfter      pgtype.Timestamptz
+	ScheduleDays  pgtype.Int2
+	ScheduleStart pgtype.Time
+	ScheduleEnd   pgtype.Time
+	ScheduleTz    pgtype.Text
+	FallbackUrl   pgtype.Text
+	CustomAlias   bool
+	DomainID      pgtype.UUID
+	IosLink       pgtype.Text
+	AndroidLink   pgtype.Text
+	GeoTargets    []byte
+	Variants      []byte
+}
+
+type LinkTag struct {
+	LinkHash string
+	TagID    uuid.UUID
+	UserID   uuid.UUID
+}
+
+type LinkVariantStat struct {
+	UserID  uuid.UUID
+	Hash    string
+	Variant string
+	Served  int64
+}
+
+type MonthlyUsage struct {
+	UserID       uuid.UUID
+	Month        pgtype.Date
+	LinksCreated int32
+}
+
+type Plan struct {
+	Name           string
+	LinksPerMonth  pgtype.Int4
+	ActiveLinks    pgtype.Int4
+	CustomAliases  pgtype.Int4
+	ApiCallsPerDay pgtype.Int4
+}
+
 type RevokedToken struct {
 	Jti       uuid.UUID
 	UserID    uuid.UUID
@@ -25,10 +113,18 @@ type RevokedToken struct {
 	ExpiresAt time.Time
 }
 
+type Tag struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	CreatedAt time.Time
+}
+
 type User struct {
 	ID                uuid.UUID
 	Email             string
 	PasswordHash      string
 	CreatedAt         time.Time
 	TotalUrlShortened int32
+	Plan              string
 }
@@ -11,10 +11,36 @@ import (
 	"github.com/google/uuid"
 )
 
+const addUserURLCounter = `-- name: AddUserURLCounter :one
+UPDATE users
+SET total_url_shortened = total_url_shortened + $1::int
+WHERE id = $2
+RETURNING id, email, password_hash, created_at, total_url_shortened, plan
+`
+
+type AddUserURLCounterParams struct {
+	Amount int32
+	ID     uuid.UUID
+}
+
+func (q *Queries) AddUserURLCounter(ctx context.Context, arg AddUserURLCounterParams) (User, error) {
+	row := q.db.QueryRow(ctx, addUserURLCounter, arg.Amount, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.PasswordHash,
+		&i.CreatedAt,
+		&i.TotalUrlShortened,
+		&i.Plan,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, email, password_hash)
 VALUES ($1, $2, $3)
-RETURNING id, email, password_hash, created_at, total_url_shortened
+RETURNING id, email, password_hash, created_at, total_url_shortened, plan
 `
 
 type CreateUserParams struct {
@@ -32,12 +58,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.PasswordHash,
 		&i.CreatedAt,
 		&i.TotalUrlShortened,
+		&i.Plan,
 	)
 	return i, err
 }
 
 const getUser = `-- name: GetUser :one
-SELECT id, email, password_hash, created_at, total_url_shortened FROM users
+SELECT id, email, password_hash, created_at, total_url_shortened, plan FROM users
 WHERE email = $1 LIMIT 1
 `
 
@@ -50,12 +77,13 @@ func (q *Queries) GetUser(ctx context.Context, email string) (User, error) {
 		&i.PasswordHash,
 		&i.CreatedAt,
 		&i.TotalUrlShortened,
+		&i.Plan,
 	)
 	return i, err
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, email, password_hash, created_at, total_url_shortened FROM users
+SELECT id, email, password_hash, created_at, total_url_shortened, plan FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -68,6 +96,7 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.PasswordHash,
 		&i.CreatedAt,
 		&i.TotalUrlShortened,
+		&i.Plan,
 	)
 	return i, err
 }
@@ -76,7 +105,7 @@ const updateUserURLCounter = `-- name: UpdateUserURLCounter :one
 UPDATE users
 SET total_url_shortened = total_url_shortened + 1
 WHERE id = $1
-RETURNING id, email, password_hash, created_at, total_url_shortened
+RETURNING id, email, password_hash, created_at, total_url_shortened, plan
 `
 
 func (q *Queries) UpdateUserURLCounter(ctx context.Context, id uuid.UUID) (User, error) {
@@ -88,6 +117,7 @@ func (q *Queries) UpdateUserURLCounter(ctx context.Context, id uuid.UUID) (User,
 		&i.PasswordHash,
 		&i.CreatedAt,
 		&i.TotalUrlShortened,
+		&i.Plan,
 	)
 	return i, err
 }
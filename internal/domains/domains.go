@@ -0,0 +1,100 @@
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	// ChallengeLabel is prepended to a hostname to name its TXT challenge record
+	ChallengeLabel = "_shortener-challenge"
+	// ChallengePrefix starts the value of a TXT challenge record
+	ChallengePrefix = "shortener-verification="
+
+	maxHostnameLength = 253
+	maxLabelLength    = 63
+)
+
+// ErrNotVerified means the challenge record is missing or holds another token
+var ErrNotVerified = errors.New("verification record not found")
+
+// Resolver looks up TXT records. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// NormalizeHostname lower cases a hostname and checks that it is a plain DNS
+// name with at least two labels, not an address or a URL.
+func NormalizeHostname(raw string) (string, error) {
+	hostname := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), ".")
+	if hostname == "" {
+		return "", fmt.Errorf("hostname must not be empty")
+	}
+	if len(hostname) > maxHostnameLength {
+		return "", fmt.Errorf("hostname must not be longer than %d characters", maxHostnameLength)
+	}
+	if net.ParseIP(hostname) != nil {
+		return "", fmt.Errorf("hostname must be a domain name, not an address")
+	}
+
+	labels := strings.Split(hostname, ".")
+	if len(labels) < 2 {
+		return "", fmt.Errorf("hostname %q needs a parent domain", hostname)
+	}
+	for _, label := range labels {
+		if label == "" || len(label) > maxLabelLength || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("invalid hostname %q", hostname)
+		}
+		for _, c := range label {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return "", fmt.Errorf("invalid hostname %q", hostname)
+			}
+		}
+	}
+	return hostname, nil
+}
+
+// NewToken makes the secret a user publishes to prove they own a domain
+func NewToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ChallengeName is the TXT record that has to hold the challenge of hostname
+func ChallengeName(hostname string) string {
+	return ChallengeLabel + "." + hostname
+}
+
+// ChallengeValue is what the TXT record has to hold for token
+func ChallengeValue(token string) string {
+	return ChallengePrefix + token
+}
+
+// Verify checks that the challenge record of hostname holds token. Missing
+// records and other tokens give ErrNotVerified, lookups that failed for other
+// reasons their own error.
+func Verify(ctx context.Context, resolver Resolver, hostname, token string) error {
+	records, err := resolver.LookupTXT(ctx, ChallengeName(hostname))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return ErrNotVerified
+		}
+		return err
+	}
+	want := ChallengeValue(token)
+	for _, record := range records {
+		if strings.TrimSpace(record) == want {
+			return nil
+		}
+	}
+	return ErrNotVerified
+}
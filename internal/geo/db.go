@@ -0,0 +1,104 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"github.com/oschwald/maxminddb-golang"
+	"log/slog"
+	"net"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DB resolves addresses to countries with a local MaxMind format database,
+// such as GeoLite2 Country. It never looks anything up over the network.
+type DB struct {
+	path    string
+	reader  atomic.Pointer[maxminddb.Reader]
+	modTime time.Time
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+// Open loads the database at path
+func Open(path string) (*DB, error) {
+	db := &DB{path: path}
+	if err := db.load(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// load reads the whole file into memory instead of mapping it, so a reader
+// that was swapped out stays valid for lookups that are still using it.
+func (db *DB) load() error {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(db.path)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return fmt.Errorf("invalid geoip database %s: %w", db.path, err)
+	}
+	db.reader.Store(reader)
+	db.modTime = info.ModTime()
+	return nil
+}
+
+// Country is the ISO code of the country ip is in, empty when the database
+// doesn't know.
+func (db *DB) Country(ip net.IP) (string, error) {
+	if db == nil || ip == nil {
+		return "", nil
+	}
+	var record countryRecord
+	if err := db.reader.Load().Lookup(ip, &record); err != nil {
+		return "", err
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode, nil
+	}
+	return record.RegisteredCountry.ISOCode, nil
+}
+
+// Watch reloads the database whenever the file changes, checking every
+// interval until ctx is done. A file that can't be loaded leaves the previous
+// database in use.
+func (db *DB) Watch(ctx context.Context, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(db.path)
+		if err != nil {
+			logger.Error("failed to check geoip database", "path", db.path, "err", err)
+			continue
+		}
+		if info.ModTime().Equal(db.modTime) {
+			continue
+		}
+		if err := db.load(); err != nil {
+			logger.Error("failed to reload geoip database", "path", db.path, "err", err)
+			continue
+		}
+		logger.Info("reloaded geoip database", "path", db.path)
+	}
+}
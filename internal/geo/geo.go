@@ -0,0 +1,82 @@
+package geo
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxRules caps the country rules of a single link
+const MaxRules = 50
+
+// Rule sends visitors from any of Countries to Link. Countries are ISO 3166-1
+// alpha-2 codes.
+type Rule struct {
+	Countries []string `form:"countries" json:"countries"`
+	Link      string   `form:"link" json:"link"`
+}
+
+// NormalizeRules upper cases the country codes of rules and checks that every
+// country has a single rule.
+func NormalizeRules(rules []Rule) ([]Rule, error) {
+	if len(rules) > MaxRules {
+		return nil, fmt.Errorf("at most %d country rules are allowed", MaxRules)
+	}
+
+	seen := make(map[string]struct{})
+	normalized := make([]Rule, 0, len(rules))
+	for i, rule := range rules {
+		if len(rule.Countries) == 0 {
+			return nil, fmt.Errorf("country rule %d has no countries", i+1)
+		}
+		if rule.Link == "" {
+			return nil, fmt.Errorf("country rule %d has no link", i+1)
+		}
+		countries := make([]string, 0, len(rule.Countries))
+		for _, country := range rule.Countries {
+			country = strings.ToUpper(strings.TrimSpace(country))
+			if !isCountryCode(country) {
+				return nil, fmt.Errorf("invalid country code %q", country)
+			}
+			if _, ok := seen[country]; ok {
+				return nil, fmt.Errorf("country %s is in more than one rule", country)
+			}
+			seen[country] = struct{}{}
+			countries = append(countries, country)
+		}
+		normalized = append(normalized, Rule{Countries: countries, Link: rule.Link})
+	}
+	return normalized, nil
+}
+
+// Match finds the link for visitors from country. Unknown countries match
+// nothing.
+func Match(rules []Rule, country string) (string, bool) {
+	if country == "" {
+		return "", false
+	}
+	for _, rule := range rules {
+		for _, c := range rule.Countries {
+			if c == country {
+				return rule.Link, true
+			}
+		}
+	}
+	return "", false
+}
+
+func isCountryCode(code string) bool {
+	return len(code) == 2 && code[0] >= 'A' && code[0] <= 'Z' && code[1] >= 'A' && code[1] <= 'Z'
+}
+
+// DecodeRules reads rules stored as JSON, no data is no rules
+func DecodeRules(data []byte) ([]Rule, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid country rules: %w", err)
+	}
+	return rules, nil
+}
@@ -0,0 +1,62 @@
+package helpers
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/redis/go-redis/v9"
+)
+
+// LinkInvalidationChannel carries the cache keys of links and domains that
+// must be dropped by every redirect replica.
+const LinkInvalidationChannel = "links:invalidate"
+
+// OpenCache connects to the redis instance in REDIS_ADDR, localhost:6379 by default
+func OpenCache() (*redis.Client, error) {
+	addr, err := GetEnv("REDIS_ADDR")
+	if err != nil {
+		return nil, err
+	}
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+	return redis.NewClient(&redis.Options{
+		Addr:     addr,
+		Password: "",
+		DB:       0,
+		Protocol: 2,
+	}), nil
+}
+
+// LinkCacheKey is where the redirect of a link is cached. Links on the default
+// short domain go by their hash alone, links on custom domains by domain and hash.
+func LinkCacheKey(domainID pgtype.UUID, urlHash string) string {
+	if !domainID.Valid {
+		return urlHash
+	}
+	return uuid.UUID(domainID.Bytes).String() + "/" + urlHash
+}
+
+// DomainCacheKey is where the redirect service caches which custom domain, if
+// any, a hostname belongs to.
+func DomainCacheKey(hostname string) string {
+	return "domain:" + hostname
+}
+
+// InvalidateLink deletes the cached redirect for a link and tells the other
+// replicas to do the same.
+func InvalidateLink(ctx context.Context, client *redis.Client, domainID pgtype.UUID, urlHash string) error {
+	return invalidate(ctx, client, LinkCacheKey(domainID, urlHash))
+}
+
+// InvalidateDomain drops what the redirect service knows about hostname
+func InvalidateDomain(ctx context.Context, client *redis.Client, hostname string) error {
+	return invalidate(ctx, client, DomainCacheKey(hostname))
+}
+
+func invalidate(ctx context.Context, client *redis.Client, key string) error {
+	if err := client.Del(ctx, key).Err(); err != nil {
+		return err
+	}
+	return client.Publish(ctx, LinkInvalidationChannel, key).Err()
+}
@@ -3,33 +3,57 @@ package helpers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/go-playground/form"
-	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
+	"io"
+	"mime"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 type contextKey string
 
 const UserIDKey contextKey = "userID"
 
-func OpenDB() (*pgx.Conn, error) {
+// AnonymousSessionKey holds the browser session of a request without an account
+const AnonymousSessionKey contextKey = "anonymousSession"
+
+const (
+	// AnonymousSessionCookie identifies the browser that shortened links
+	// without an account, so they can be claimed after signing up
+	AnonymousSessionCookie = "anonymous_session"
+	// AnonymousSessionHeader carries that session from the gateway to the shortener
+	AnonymousSessionHeader = "X-Anonymous-Session"
+)
+
+// MaxJSONBodyBytes caps the size of JSON request bodies decoded by DecodeRequest
+const MaxJSONBodyBytes = 1 << 20
+
+var ErrUnsupportedMediaType = errors.New("unsupported media type")
+
+// ErrBodyTooLarge is returned for bodies over the limit of the endpoint
+var ErrBodyTooLarge = errors.New("body too large")
+
+func OpenDB() (*pgxpool.Pool, error) {
 	if err := godotenv.Load(); err != nil {
 		return nil, err
 	}
 	dbUrl := os.Getenv("DB_URL")
-	conn, err := pgx.Connect(context.Background(), dbUrl)
+	pool, err := pgxpool.New(context.Background(), dbUrl)
 	if err != nil {
 		return nil, err
 	}
-	err = conn.Ping(context.Background())
+	err = pool.Ping(context.Background())
 	if err != nil {
-		_ = conn.Close(context.Background())
+		pool.Close()
 		return nil, err
 	}
 
-	return conn, nil
+	return pool, nil
 }
 
 func GetEnv(env string) (string, error) {
@@ -40,6 +64,15 @@ func GetEnv(env string) (string, error) {
 	return port, nil
 }
 
+// GetEnvBool reads a boolean setting, returning def when it's not set
+func GetEnvBool(env string, def bool) (bool, error) {
+	value, err := GetEnv(env)
+	if err != nil || value == "" {
+		return def, err
+	}
+	return strconv.ParseBool(value)
+}
+
 func ParseForm(r *http.Request, dest any) error {
 	if err := r.ParseForm(); err != nil {
 		return err
@@ -52,6 +85,53 @@ func ParseForm(r *http.Request, dest any) error {
 	return nil
 }
 
+// DecodeRequest decodes the request body into dest based on its Content-Type.
+// JSON bodies go through DecodeJSON, url-encoded forms through ParseForm.
+func DecodeRequest(w http.ResponseWriter, r *http.Request, dest any) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return ParseForm(r, dest)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, contentType)
+	}
+
+	switch mediaType {
+	case "application/json":
+		return DecodeJSON(w, r, dest, MaxJSONBodyBytes)
+	case "application/x-www-form-urlencoded":
+		return ParseForm(r, dest)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+}
+
+// DecodeJSON decodes a single JSON value from the body into dest, rejecting
+// unknown fields, trailing data and bodies larger than maxBytes.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dest any, maxBytes int64) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dest); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			return fmt.Errorf("%w: must not be larger than %d bytes", ErrBodyTooLarge, maxBytesErr.Limit)
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+		default:
+			return err
+		}
+	}
+	if err := decoder.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
 // InvalidCredentialsResponse todo: InvalidCredentialsResponse need to confirm that it's working
 func InvalidCredentialsResponse(w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json")
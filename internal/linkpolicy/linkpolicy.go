@@ -0,0 +1,273 @@
+package linkpolicy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	CodeSchemeNotAllowed = "scheme_not_allowed"
+	CodeDomainBlocked    = "domain_blocked"
+	CodePrivateAddress   = "private_address"
+	CodeUnresolvableHost = "unresolvable_host"
+
+	DefaultResolveTimeout = 2 * time.Second
+)
+
+var DefaultSchemes = []string{"http", "https"}
+
+// Violation explains why a destination was rejected
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"error"`
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// Resolver looks up the addresses behind a hostname. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type Policy struct {
+	schemes      map[string]struct{}
+	blocklist    *Blocklist
+	blockPrivate bool
+	resolver     Resolver
+}
+
+type Config struct {
+	// AllowedSchemes defaults to DefaultSchemes when empty
+	AllowedSchemes []string
+	Blocklist      *Blocklist
+	// BlockPrivate rejects loopback, private, link-local and other non public addresses
+	BlockPrivate bool
+	// Resolver is used to check what hostnames point at. A nil Resolver only
+	// checks IP literals.
+	Resolver Resolver
+}
+
+func New(cfg Config) *Policy {
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	p := &Policy{
+		schemes:      make(map[string]struct{}, len(schemes)),
+		blocklist:    cfg.Blocklist,
+		blockPrivate: cfg.BlockPrivate,
+		resolver:     cfg.Resolver,
+	}
+	for _, scheme := range schemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		if scheme != "" {
+			p.schemes[scheme] = struct{}{}
+		}
+	}
+	return p
+}
+
+// Check validates a canonicalized destination. Rejections are returned as
+// *Violation, anything else is an internal failure.
+func (p *Policy) Check(ctx context.Context, u *url.URL) error {
+	if _, ok := p.schemes[u.Scheme]; !ok {
+		return &Violation{CodeSchemeNotAllowed, fmt.Sprintf("scheme %q is not allowed", u.Scheme)}
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if p.blocklist.Matches(host) {
+		return &Violation{CodeDomainBlocked, fmt.Sprintf("domain %q is blocked", host)}
+	}
+
+	if !p.blockPrivate || host == "" {
+		return nil
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil && endsInNumber(host) {
+		// browsers read hosts like 2130706433 or 0x7f.1 as IPv4 addresses
+		var ok bool
+		if addr, ok = parseIPv4Numeric(host); !ok {
+			return &Violation{CodePrivateAddress, fmt.Sprintf("host %q is not a valid address", host)}
+		}
+		err = nil
+	}
+	if err == nil {
+		if !IsPublic(addr) {
+			return &Violation{CodePrivateAddress, fmt.Sprintf("address %s is not public", addr)}
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return &Violation{CodePrivateAddress, fmt.Sprintf("host %q is not public", host)}
+	}
+	if p.resolver == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, DefaultResolveTimeout)
+	defer cancel()
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		// without its addresses nothing says the host isn't private
+		return &Violation{CodeUnresolvableHost, fmt.Sprintf("host %q could not be resolved", host)}
+	}
+	for _, ipAddr := range addrs {
+		addr, ok := netip.AddrFromSlice(ipAddr.IP)
+		if ok && !IsPublic(addr) {
+			return &Violation{CodePrivateAddress, fmt.Sprintf("host %q resolves to non public address %s", host, addr.Unmap())}
+		}
+	}
+	return nil
+}
+
+// endsInNumber reports whether the last label of host is a decimal or hex
+// number, which makes the whole host an IPv4 address to URL parsers
+func endsInNumber(host string) bool {
+	labels := strings.Split(host, ".")
+	last := labels[len(labels)-1]
+	if hex, ok := strings.CutPrefix(last, "0x"); ok {
+		return strings.Trim(hex, "0123456789abcdef") == ""
+	}
+	return last != "" && strings.Trim(last, "0123456789") == ""
+}
+
+// parseIPv4Numeric reads the IPv4 forms inet_aton accepts: one to four decimal,
+// 0x hex or 0 prefixed octal parts, the last of which fills the remaining bytes.
+func parseIPv4Numeric(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+	numbers := make([]uint64, len(parts))
+	for i, part := range parts {
+		base := 10
+		switch {
+		case strings.HasPrefix(part, "0x"):
+			part, base = part[2:], 16
+			if part == "" {
+				part = "0"
+			}
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+		n, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		numbers[i] = n
+	}
+
+	var ip uint64
+	for i, n := range numbers[:len(numbers)-1] {
+		if n > 0xff {
+			return netip.Addr{}, false
+		}
+		ip |= n << (8 * (3 - i))
+	}
+	last := numbers[len(numbers)-1]
+	if last >= 1<<(8*(5-len(numbers))) {
+		return netip.Addr{}, false
+	}
+	ip |= last
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
+
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublic reports whether addr is a globally routable unicast address
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Blocklist holds exact domains and "*.domain" wildcards that match any
+// subdomain of domain.
+type Blocklist struct {
+	exact     map[string]struct{}
+	wildcards map[string]struct{}
+}
+
+func NewBlocklist(entries []string) *Blocklist {
+	b := &Blocklist{
+		exact:     map[string]struct{}{},
+		wildcards: map[string]struct{}{},
+	}
+	for _, entry := range entries {
+		entry = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(entry)), ".")
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if suffix, ok := strings.CutPrefix(entry, "*."); ok {
+			b.wildcards[suffix] = struct{}{}
+			continue
+		}
+		b.exact[entry] = struct{}{}
+	}
+	return b
+}
+
+// LoadBlocklist reads one entry per line, lines starting with # are comments
+func LoadBlocklist(path string) (*Blocklist, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewBlocklist(entries), nil
+}
+
+func (b *Blocklist) Matches(host string) bool {
+	if b == nil {
+		return false
+	}
+	if _, ok := b.exact[host]; ok {
+		return true
+	}
+	for rest := host; ; {
+		_, parent, found := strings.Cut(rest, ".")
+		if !found {
+			return false
+		}
+		if _, ok := b.wildcards[parent]; ok {
+			return true
+		}
+		rest = parent
+	}
+}
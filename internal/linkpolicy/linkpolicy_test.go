@@ -0,0 +1,149 @@
+package linkpolicy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+type failingResolver struct{}
+
+func (failingResolver) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return nil, context.DeadlineExceeded
+}
+
+func TestCheck(t *testing.T) {
+	resolver := fakeResolver{
+		"example.com":  {"93.184.215.14"},
+		"bad.test":     {"93.184.215.14"},
+		"internal.lan": {"10.0.0.5"},
+		"mixed.test":   {"93.184.215.14", "127.0.0.1"},
+		"empty.test":   {},
+	}
+	policy := New(Config{
+		Blocklist:    NewBlocklist([]string{"evil.test", "*.bad.test"}),
+		BlockPrivate: true,
+		Resolver:     resolver,
+	})
+
+	tests := []struct {
+		link string
+		code string
+	}{
+		{"https://example.com/page", ""},
+		{"ftp://example.com/file", CodeSchemeNotAllowed},
+		{"https://evil.test/", CodeDomainBlocked},
+		{"https://www.bad.test/", CodeDomainBlocked},
+		{"https://bad.test/", ""},
+		{"http://127.0.0.1/", CodePrivateAddress},
+		{"http://[::1]/", CodePrivateAddress},
+		{"http://[::ffff:10.0.0.1]/", CodePrivateAddress},
+		{"http://169.254.169.254/", CodePrivateAddress},
+		{"http://localhost:8080/", CodePrivateAddress},
+		{"http://api.localhost/", CodePrivateAddress},
+		{"http://internal.lan/", CodePrivateAddress},
+		{"http://mixed.test/", CodePrivateAddress},
+		{"http://missing.test/", CodeUnresolvableHost},
+		{"http://empty.test/", CodeUnresolvableHost},
+		{"http://8.8.8.8/", ""},
+
+		// numeric hosts are addresses, whatever form they are written in
+		{"http://2130706433/", CodePrivateAddress},
+		{"http://0x7f.1/", CodePrivateAddress},
+		{"http://0x7f000001/", CodePrivateAddress},
+		{"http://017700000001/", CodePrivateAddress},
+		{"http://0177.0.0.1/", CodePrivateAddress},
+		{"http://127.1/", CodePrivateAddress},
+		{"http://10.1.1/", CodePrivateAddress},
+		{"http://0/", CodePrivateAddress},
+		{"http://134744072/", ""},
+		{"http://0x8.0x8.0x8.0x8/", ""},
+		{"http://4294967296/", CodePrivateAddress},
+		{"http://1.2.3.256/", CodePrivateAddress},
+		{"http://08.1/", CodePrivateAddress},
+		{"http://1.2.3.4.5/", CodePrivateAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			u, err := url.Parse(tt.link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.Check(context.Background(), u)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("Check() = %v, want no error", err)
+				}
+				return
+			}
+			var violation *Violation
+			if !errors.As(err, &violation) {
+				t.Fatalf("Check() = %v, want a %s violation", err, tt.code)
+			}
+			if violation.Code != tt.code {
+				t.Fatalf("Check() code = %s, want %s (%v)", violation.Code, tt.code, violation)
+			}
+		})
+	}
+}
+
+func TestCheckFailsClosed(t *testing.T) {
+	policy := New(Config{BlockPrivate: true, Resolver: failingResolver{}})
+	u, _ := url.Parse("https://example.com/")
+
+	var violation *Violation
+	err := policy.Check(context.Background(), u)
+	if !errors.As(err, &violation) || violation.Code != CodeUnresolvableHost {
+		t.Fatalf("Check() = %v, want a %s violation", err, CodeUnresolvableHost)
+	}
+}
+
+func TestParseIPv4Numeric(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"2130706433", "127.0.0.1"},
+		{"0x7f.1", "127.0.0.1"},
+		{"017700000001", "127.0.0.1"},
+		{"0x7f.0.0.0x1", "127.0.0.1"},
+		{"192.168.257", "192.168.1.1"},
+		{"10.0x10203", "10.1.2.3"},
+		{"0x", "0.0.0.0"},
+		{"4294967295", "255.255.255.255"},
+		{"4294967296", ""},
+		{"256.1", ""},
+		{"1.2.3.256", ""},
+		{"09", ""},
+		{"1..2", ""},
+		{"1.2.3.4.5", ""},
+	}
+	for _, tt := range tests {
+		addr, ok := parseIPv4Numeric(tt.host)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("parseIPv4Numeric(%q) = %s, want no address", tt.host, addr)
+			}
+			continue
+		}
+		if !ok || addr.String() != tt.want {
+			t.Errorf("parseIPv4Numeric(%q) = %s, %v, want %s", tt.host, addr, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// links name their time zone, the embedded database keeps that working on
+	// hosts without zoneinfo
+	_ "time/tzdata"
+)
+
+// AllDays is the day mask of a schedule that runs every day
+const AllDays = 1<<7 - 1
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Recurring opens a link between Start and End on the days in Days, in the
+// wall clock of Location. An End at or before Start runs past midnight into
+// the next day, and a Start equal to End keeps the link open all day.
+type Recurring struct {
+	// Days is a mask with bit time.Weekday set for every day the window opens
+	Days     int
+	Start    time.Duration
+	End      time.Duration
+	Location *time.Location
+}
+
+// Window is when a link may be visited. Zero bounds are open ended and a nil
+// Recurring doesn't restrict the time of day.
+type Window struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+	Recurring *Recurring
+}
+
+// Active reports whether the window is open at t
+func (w Window) Active(t time.Time) bool {
+	if !w.NotBefore.IsZero() && t.Before(w.NotBefore) {
+		return false
+	}
+	if !w.NotAfter.IsZero() && !t.Before(w.NotAfter) {
+		return false
+	}
+	if w.Recurring == nil {
+		return true
+	}
+	for _, span := range w.Recurring.spans(t) {
+		if !t.Before(span[0]) && t.Before(span[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextChange is the first moment after t at which Active may change. It is
+// zero when the window never changes again.
+func (w Window) NextChange(t time.Time) time.Time {
+	var next time.Time
+	consider := func(candidate time.Time) {
+		if candidate.After(t) && (next.IsZero() || candidate.Before(next)) {
+			next = candidate
+		}
+	}
+	consider(w.NotBefore)
+	consider(w.NotAfter)
+	if w.Recurring != nil {
+		for _, span := range w.Recurring.spans(t) {
+			consider(span[0])
+			consider(span[1])
+		}
+	}
+	if !w.NotAfter.IsZero() && !t.Before(w.NotAfter) {
+		// closed for good
+		return time.Time{}
+	}
+	return next
+}
+
+// Ended reports whether the window is closed at t and never opens again
+func (w Window) Ended(t time.Time) bool {
+	return !w.Active(t) && w.NextOpening(t).IsZero()
+}
+
+// NextOpening is the first moment after t at which the window is open, or zero
+// if it never opens again.
+func (w Window) NextOpening(t time.Time) time.Time {
+	// a week of boundaries covers every recurring pattern
+	for i := 0; i < 32; i++ {
+		t = w.NextChange(t)
+		if t.IsZero() || w.Active(t) {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// spans lists the windows that start between the day before t and a week
+// after it, which covers the one t may be in and the next one.
+func (r *Recurring) spans(t time.Time) [][2]time.Time {
+	local := t.In(r.Location)
+	year, month, day := local.Date()
+
+	var spans [][2]time.Time
+	for offset := -1; offset <= 8; offset++ {
+		date := time.Date(year, month, day+offset, 0, 0, 0, 0, r.Location)
+		if r.Days&(1<<date.Weekday()) == 0 {
+			continue
+		}
+		start := atClock(date, r.Start)
+		end := atClock(date, r.End)
+		if !end.After(start) {
+			end = atClock(date.AddDate(0, 0, 1), r.End)
+		}
+		spans = append(spans, [2]time.Time{start, end})
+	}
+	return spans
+}
+
+// atClock is the wall clock time of day on date. Building it from the hour and
+// minute keeps daylight saving changes out of the way.
+func atClock(date time.Time, clock time.Duration) time.Time {
+	year, month, day := date.Date()
+	hour, minute := int(clock/time.Hour), int(clock%time.Hour/time.Minute)
+	return time.Date(year, month, day, hour, minute, 0, 0, date.Location())
+}
+
+// ParseDays reads day names such as "mon" or ranges such as "mon-fri" into a
+// day mask. No names means every day.
+func ParseDays(names []string) (int, error) {
+	if len(names) == 0 {
+		return AllDays, nil
+	}
+	mask := 0
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		from, to, isRange := strings.Cut(name, "-")
+		first, ok := dayNames[from]
+		if !ok {
+			return 0, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return 0, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			mask |= 1 << day
+			if day == last {
+				break
+			}
+		}
+	}
+	return mask, nil
+}
+
+// FormatDays is the inverse of ParseDays, listing every day on its own
+func FormatDays(mask int) []string {
+	days := make([]string, 0, 7)
+	for _, name := range []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"} {
+		if mask&(1<<dayNames[name]) != 0 {
+			days = append(days, name)
+		}
+	}
+	return days
+}
+
+// ParseClock reads a 24 hour "15:04" time of day as an offset from midnight
+func ParseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("time of day must look like 15:04")
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func FormatClock(clock time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(clock.Hours()), int(clock.Minutes())%60)
+}
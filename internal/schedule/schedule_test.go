@@ -0,0 +1,211 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func utc(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func recurring(days int, start, end string, loc *time.Location) *Recurring {
+	startClock, err := ParseClock(start)
+	if err != nil {
+		panic(err)
+	}
+	endClock, err := ParseClock(end)
+	if err != nil {
+		panic(err)
+	}
+	return &Recurring{Days: days, Start: startClock, End: endClock, Location: loc}
+}
+
+func checkActive(t *testing.T, w Window, cases map[string]bool) {
+	t.Helper()
+	for at, want := range cases {
+		if got := w.Active(utc(at)); got != want {
+			t.Errorf("Active(%s) = %v, want %v", at, got, want)
+		}
+	}
+}
+
+func TestOvernightWindow(t *testing.T) {
+	// fridays from 22:00 until 02:00 on saturday
+	w := Window{Recurring: recurring(1<<time.Friday, "22:00", "02:00", time.UTC)}
+	checkActive(t, w, map[string]bool{
+		"2025-06-13T21:59:00Z": false,
+		"2025-06-13T22:00:00Z": true,
+		"2025-06-13T23:30:00Z": true,
+		"2025-06-14T01:59:00Z": true,
+		"2025-06-14T02:00:00Z": false,
+		"2025-06-14T22:30:00Z": false,
+		"2025-06-12T23:00:00Z": false,
+	})
+
+	if got, want := w.NextChange(utc("2025-06-14T01:00:00Z")), utc("2025-06-14T02:00:00Z"); !got.Equal(want) {
+		t.Errorf("NextChange inside the span = %s, want %s", got, want)
+	}
+	if got, want := w.NextOpening(utc("2025-06-14T02:00:00Z")), utc("2025-06-20T22:00:00Z"); !got.Equal(want) {
+		t.Errorf("NextOpening after the span = %s, want %s", got, want)
+	}
+}
+
+func TestAllDayWindow(t *testing.T) {
+	// a start equal to the end keeps the link open for a whole day from then
+	w := Window{Recurring: recurring(1<<time.Monday, "09:00", "09:00", time.UTC)}
+	checkActive(t, w, map[string]bool{
+		"2025-06-16T08:59:00Z": false,
+		"2025-06-16T09:00:00Z": true,
+		"2025-06-16T23:59:00Z": true,
+		"2025-06-17T08:59:00Z": true,
+		"2025-06-17T09:00:00Z": false,
+	})
+}
+
+func TestSpringForward(t *testing.T) {
+	// Europe/Berlin skips from 02:00 to 03:00 on 2025-03-30
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	w := Window{Recurring: recurring(AllDays, "01:00", "04:00", berlin)}
+	checkActive(t, w, map[string]bool{
+		"2025-03-29T23:59:00Z": false,
+		"2025-03-30T00:00:00Z": true,  // 01:00 CET
+		"2025-03-30T01:30:00Z": true,  // 03:30 CEST
+		"2025-03-30T02:00:00Z": false, // 04:00 CEST, two hours after opening
+	})
+	if got, want := w.NextChange(utc("2025-03-30T00:30:00Z")), utc("2025-03-30T02:00:00Z"); !got.Equal(want) {
+		t.Errorf("NextChange across the gap = %s, want %s", got, want)
+	}
+
+	// a window starting in the skipped hour still opens that day
+	gap := Window{Recurring: recurring(AllDays, "02:30", "05:00", berlin)}
+	checkActive(t, gap, map[string]bool{
+		"2025-03-30T01:45:00Z": true,  // 03:45 CEST
+		"2025-03-30T03:00:00Z": false, // 05:00 CEST
+	})
+}
+
+func TestFallBack(t *testing.T) {
+	// Europe/Berlin repeats 02:00 to 03:00 on 2025-10-26
+	berlin := mustLoad(t, "Europe/Berlin")
+
+	w := Window{Recurring: recurring(AllDays, "01:00", "04:00", berlin)}
+	checkActive(t, w, map[string]bool{
+		"2025-10-25T22:59:00Z": false,
+		"2025-10-25T23:00:00Z": true, // 01:00 CEST
+		"2025-10-26T01:30:00Z": true, // the second 02:30, in CET
+		"2025-10-26T02:59:00Z": true,
+		"2025-10-26T03:00:00Z": false, // 04:00 CET, four hours after opening
+	})
+	if got, want := w.NextChange(utc("2025-10-26T00:30:00Z")), utc("2025-10-26T03:00:00Z"); !got.Equal(want) {
+		t.Errorf("NextChange across the repeated hour = %s, want %s", got, want)
+	}
+}
+
+func TestNextChangeAtBoundaries(t *testing.T) {
+	w := Window{Recurring: recurring(AllDays, "09:00", "17:00", time.UTC)}
+
+	tests := []struct {
+		at     string
+		active bool
+		next   string
+	}{
+		{"2025-06-16T08:59:59Z", false, "2025-06-16T09:00:00Z"},
+		{"2025-06-16T09:00:00Z", true, "2025-06-16T17:00:00Z"},
+		{"2025-06-16T16:59:59Z", true, "2025-06-16T17:00:00Z"},
+		{"2025-06-16T17:00:00Z", false, "2025-06-17T09:00:00Z"},
+	}
+	for _, tt := range tests {
+		at := utc(tt.at)
+		if got := w.Active(at); got != tt.active {
+			t.Errorf("Active(%s) = %v, want %v", tt.at, got, tt.active)
+		}
+		if got, want := w.NextChange(at), utc(tt.next); !got.Equal(want) {
+			t.Errorf("NextChange(%s) = %s, want %s", tt.at, got, want)
+		}
+	}
+}
+
+func TestWindowBounds(t *testing.T) {
+	w := Window{
+		NotBefore: utc("2025-06-16T12:00:00Z"),
+		NotAfter:  utc("2025-06-18T12:00:00Z"),
+		Recurring: recurring(AllDays, "09:00", "17:00", time.UTC),
+	}
+	checkActive(t, w, map[string]bool{
+		"2025-06-16T10:00:00Z": false, // in the span, before not_before
+		"2025-06-16T12:00:00Z": true,
+		"2025-06-18T11:59:00Z": true,
+		"2025-06-18T12:00:00Z": false, // in the span, at not_after
+	})
+
+	if got, want := w.NextOpening(utc("2025-06-16T10:00:00Z")), w.NotBefore; !got.Equal(want) {
+		t.Errorf("NextOpening before not_before = %s, want %s", got, want)
+	}
+	if got, want := w.NextChange(utc("2025-06-18T10:00:00Z")), w.NotAfter; !got.Equal(want) {
+		t.Errorf("NextChange before not_after = %s, want %s", got, want)
+	}
+	if got := w.NextChange(w.NotAfter); !got.IsZero() {
+		t.Errorf("NextChange at not_after = %s, want zero", got)
+	}
+	if !w.Ended(utc("2025-06-18T12:00:00Z")) {
+		t.Error("Ended at not_after = false, want true")
+	}
+	if w.Ended(utc("2025-06-17T18:00:00Z")) {
+		t.Error("Ended between two spans = true, want false")
+	}
+}
+
+func TestWindowWithoutSchedule(t *testing.T) {
+	w := Window{}
+	if !w.Active(utc("2025-06-16T10:00:00Z")) {
+		t.Error("an open window is not active")
+	}
+	if got := w.NextChange(utc("2025-06-16T10:00:00Z")); !got.IsZero() {
+		t.Errorf("NextChange of an open window = %s, want zero", got)
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+		{[]string{"mon-fri"}, []string{"mon", "tue", "wed", "thu", "fri"}},
+		{[]string{"fri-mon"}, []string{"sun", "mon", "fri", "sat"}},
+		{[]string{" Sat ", "sun"}, []string{"sun", "sat"}},
+	}
+	for _, tt := range tests {
+		mask, err := ParseDays(tt.names)
+		if err != nil {
+			t.Fatalf("ParseDays(%q): %v", tt.names, err)
+		}
+		got := FormatDays(mask)
+		if len(got) != len(tt.want) {
+			t.Fatalf("ParseDays(%q) = %v, want %v", tt.names, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Fatalf("ParseDays(%q) = %v, want %v", tt.names, got, tt.want)
+			}
+		}
+	}
+	if _, err := ParseDays([]string{"mon-funday"}); err == nil {
+		t.Error("ParseDays accepted an unknown day")
+	}
+}
@@ -0,0 +1,211 @@
+package shortcode
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"github.com/jxskiss/base62"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	StrategyHash    = "hash"
+	StrategyRandom  = "random"
+	StrategyCounter = "counter"
+	StrategyTime    = "time"
+
+	// MaxLength matches the size of the links.hash column
+	MaxLength = 20
+	// MaxAttempts is how many codes a caller should try before giving up on collisions
+	MaxAttempts = 3
+
+	DefaultLength = 10
+
+	// sortedAlphabet is in ASCII order so fixed-width codes sort like the numbers they encode
+	sortedAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// DefaultShuffledAlphabet hides the sequence behind counter codes
+	DefaultShuffledAlphabet = "CkAvprUG0JOB8TzsLeMmIVShlxgcH1dXwoE7aniZjFtQR52DWubN6Yq43fP9yK"
+)
+
+// Generator produces short codes. attempt starts at 0 and grows every time the
+// previous code collided with an existing link, so deterministic generators can
+// derive a different code on each try.
+type Generator interface {
+	Generate(ctx context.Context, url string, attempt int) (string, error)
+}
+
+type Config struct {
+	Strategy string
+	// Length is the number of characters in a generated code. Zero keeps the
+	// default for the strategy.
+	Length int
+	// Alphabet is the shuffled alphabet used by the counter strategy
+	Alphabet string
+	// NextCounter returns the next value of a shared monotonic counter
+	NextCounter func(ctx context.Context) (int64, error)
+}
+
+func New(cfg Config) (Generator, error) {
+	length := cfg.Length
+	if length < 0 || length+MaxAttempts-1 > MaxLength {
+		return nil, fmt.Errorf("code length must be between 1 and %d", MaxLength-MaxAttempts+1)
+	}
+
+	switch strings.ToLower(cfg.Strategy) {
+	case "", StrategyHash:
+		return HashGenerator{Length: length}, nil
+	case StrategyRandom:
+		return RandomGenerator{Length: orDefault(length, DefaultLength)}, nil
+	case StrategyCounter:
+		if cfg.NextCounter == nil {
+			return nil, fmt.Errorf("counter strategy needs a counter source")
+		}
+		alphabet := cfg.Alphabet
+		if alphabet == "" {
+			alphabet = DefaultShuffledAlphabet
+		}
+		if err := validateAlphabet(alphabet); err != nil {
+			return nil, err
+		}
+		return CounterGenerator{
+			Length:   orDefault(length, 6),
+			encoding: base62.NewEncoding(alphabet),
+			zero:     alphabet[0],
+			next:     cfg.NextCounter,
+		}, nil
+	case StrategyTime:
+		length = orDefault(length, 12)
+		if length < timestampChars+2 {
+			return nil, fmt.Errorf("time codes need at least %d characters", timestampChars+2)
+		}
+		return TimeGenerator{Length: length}, nil
+	default:
+		return nil, fmt.Errorf("unknown code strategy %q", cfg.Strategy)
+	}
+}
+
+// Deterministic reports whether g always gives a url the same code. Only then
+// does a taken code say the url was shortened before, every other strategy
+// hands out a new code each time.
+func Deterministic(g Generator) bool {
+	_, ok := g.(HashGenerator)
+	return ok
+}
+
+// HashGenerator derives the code from the SHA-256 of the url, so the same url
+// always maps to the same code. With no Length it keeps the original scheme of
+// base62 encoding a 7, 8 then 9 byte prefix of the hash.
+type HashGenerator struct {
+	Length int
+}
+
+func (g HashGenerator) Generate(_ context.Context, url string, attempt int) (string, error) {
+	sum := sha256.Sum256([]byte(url))
+	if g.Length == 0 {
+		return base62.EncodeToString(sum[:7+attempt]), nil
+	}
+
+	encoded := base62.EncodeToString(sum[:])
+	return encoded[:g.Length+attempt], nil
+}
+
+// RandomGenerator draws every character from crypto/rand, making codes
+// impossible to guess from the url.
+type RandomGenerator struct {
+	Length int
+}
+
+func (g RandomGenerator) Generate(_ context.Context, _ string, _ int) (string, error) {
+	return randomString(g.Length)
+}
+
+// CounterGenerator encodes a monotonic counter with a shuffled alphabet,
+// left padded to Length.
+type CounterGenerator struct {
+	Length   int
+	encoding *base62.Encoding
+	zero     byte
+	next     func(ctx context.Context) (int64, error)
+}
+
+func (g CounterGenerator) Generate(ctx context.Context, _ string, _ int) (string, error) {
+	n, err := g.next(ctx)
+	if err != nil {
+		return "", err
+	}
+	code := g.encoding.FormatUint(uint64(n))
+	if len(code) > MaxLength {
+		return "", fmt.Errorf("counter %d does not fit in a code", n)
+	}
+	if pad := g.Length - len(code); pad > 0 {
+		code = append([]byte(strings.Repeat(string(g.zero), pad)), code...)
+	}
+	return string(code), nil
+}
+
+// timestampChars is enough base62 characters to hold a 48 bit millisecond timestamp
+const timestampChars = 9
+
+// TimeGenerator prefixes a fixed width millisecond timestamp to random
+// characters, so codes sort by creation time. Codes made in the same
+// millisecond only differ in the random characters, the default length leaves
+// three of them and relies on the caller retrying collisions under load.
+type TimeGenerator struct {
+	Length int
+}
+
+func (g TimeGenerator) Generate(_ context.Context, _ string, _ int) (string, error) {
+	ms := uint64(time.Now().UnixMilli()) & (1<<48 - 1)
+	var ts [timestampChars]byte
+	for i := timestampChars - 1; i >= 0; i-- {
+		ts[i] = sortedAlphabet[ms%62]
+		ms /= 62
+	}
+
+	suffix, err := randomString(g.Length - timestampChars)
+	if err != nil {
+		return "", err
+	}
+	return string(ts[:]) + suffix, nil
+}
+
+func randomString(length int) (string, error) {
+	max := big.NewInt(int64(len(sortedAlphabet)))
+	buf := make([]byte, length)
+	for i := range buf {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		buf[i] = sortedAlphabet[n.Int64()]
+	}
+	return string(buf), nil
+}
+
+func validateAlphabet(alphabet string) error {
+	if len(alphabet) != 62 {
+		return fmt.Errorf("alphabet must be 62 characters, got %d", len(alphabet))
+	}
+	var seen [256]bool
+	for i := 0; i < len(alphabet); i++ {
+		c := alphabet[i]
+		if !strings.ContainsRune(sortedAlphabet, rune(c)) {
+			return fmt.Errorf("alphabet may only contain letters and digits")
+		}
+		if seen[c] {
+			return fmt.Errorf("alphabet contains %q more than once", c)
+		}
+		seen[c] = true
+	}
+	return nil
+}
+
+func orDefault(value, def int) int {
+	if value == 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,206 @@
+package shortcode
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func counterFrom(start int64) func(context.Context) (int64, error) {
+	var n atomic.Int64
+	n.Store(start - 1)
+	return func(context.Context) (int64, error) {
+		return n.Add(1), nil
+	}
+}
+
+func mustNew(t *testing.T, cfg Config) Generator {
+	t.Helper()
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New(%+v): %v", cfg, err)
+	}
+	return g
+}
+
+func generate(t *testing.T, g Generator, url string, attempt int) string {
+	t.Helper()
+	code, err := g.Generate(context.Background(), url, attempt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func onlyFrom(code, alphabet string) bool {
+	return strings.Trim(code, alphabet) == ""
+}
+
+func TestNew(t *testing.T) {
+	valid := []Config{
+		{},
+		{Strategy: "HASH", Length: 8},
+		{Strategy: StrategyRandom},
+		{Strategy: StrategyCounter, NextCounter: counterFrom(0)},
+		{Strategy: StrategyCounter, Alphabet: sortedAlphabet, NextCounter: counterFrom(0)},
+		{Strategy: StrategyTime},
+		{Strategy: StrategyRandom, Length: MaxLength - MaxAttempts + 1},
+	}
+	for _, cfg := range valid {
+		if _, err := New(cfg); err != nil {
+			t.Errorf("New(%+v): %v", cfg, err)
+		}
+	}
+
+	invalid := map[string]Config{
+		"negative length":      {Length: -1},
+		"length over column":   {Strategy: StrategyRandom, Length: MaxLength},
+		"unknown strategy":     {Strategy: "sequential"},
+		"counter without next": {Strategy: StrategyCounter},
+		"short alphabet":       {Strategy: StrategyCounter, Alphabet: "abc", NextCounter: counterFrom(0)},
+		"repeated character":   {Strategy: StrategyCounter, Alphabet: "0" + sortedAlphabet[:61][1:] + "0", NextCounter: counterFrom(0)},
+		"invalid character":    {Strategy: StrategyCounter, Alphabet: "-" + sortedAlphabet[1:], NextCounter: counterFrom(0)},
+		"time code too short":  {Strategy: StrategyTime, Length: timestampChars + 1},
+	}
+	for name, cfg := range invalid {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New accepted %s", name)
+		}
+	}
+}
+
+func TestHashGenerator(t *testing.T) {
+	for _, length := range []int{0, 6, 10, MaxLength - MaxAttempts + 1} {
+		g := mustNew(t, Config{Strategy: StrategyHash, Length: length})
+		seen := map[string]bool{}
+		for attempt := 0; attempt < MaxAttempts; attempt++ {
+			code := generate(t, g, "https://example.com/page", attempt)
+			if again := generate(t, g, "https://example.com/page", attempt); again != code {
+				t.Errorf("length %d attempt %d: %s then %s for the same url", length, attempt, code, again)
+			}
+			if length > 0 && len(code) != length+attempt {
+				t.Errorf("length %d attempt %d: code %s has %d characters", length, attempt, code, len(code))
+			}
+			if len(code) > MaxLength || !onlyFrom(code, sortedAlphabet) {
+				t.Errorf("length %d attempt %d: invalid code %s", length, attempt, code)
+			}
+			if seen[code] {
+				t.Errorf("length %d: attempt %d repeats code %s", length, attempt, code)
+			}
+			seen[code] = true
+		}
+		if generate(t, g, "https://example.com/other", 0) == generate(t, g, "https://example.com/page", 0) {
+			t.Errorf("length %d: two urls got the same code", length)
+		}
+	}
+}
+
+func TestRandomGenerator(t *testing.T) {
+	g := mustNew(t, Config{Strategy: StrategyRandom, Length: 8})
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		code := generate(t, g, "https://example.com/", 0)
+		if len(code) != 8 || !onlyFrom(code, sortedAlphabet) {
+			t.Fatalf("invalid code %q", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %s came up twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestCounterGenerator(t *testing.T) {
+	g := mustNew(t, Config{Strategy: StrategyCounter, Length: 4, NextCounter: counterFrom(0)})
+
+	if code := generate(t, g, "", 0); code != strings.Repeat(DefaultShuffledAlphabet[:1], 4) {
+		t.Errorf("counter 0 = %s, want it padded with the first character", code)
+	}
+	seen := map[string]bool{}
+	for i := 1; i < 20000; i++ {
+		code := generate(t, g, "", 0)
+		if len(code) != 4 || !onlyFrom(code, DefaultShuffledAlphabet) {
+			t.Fatalf("counter %d: invalid code %q", i, code)
+		}
+		if seen[code] {
+			t.Fatalf("counter %d: code %s came up twice", i, code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestCounterGeneratorGrowsPastLength(t *testing.T) {
+	g := mustNew(t, Config{Strategy: StrategyCounter, Length: 2, NextCounter: counterFrom(62*62 - 1)})
+	if code := generate(t, g, "", 0); len(code) != 2 {
+		t.Errorf("last two character counter = %s", code)
+	}
+	if code := generate(t, g, "", 0); len(code) != 3 {
+		t.Errorf("first counter past two characters = %s, want three characters", code)
+	}
+}
+
+func TestCounterGeneratorUsesAlphabet(t *testing.T) {
+	alphabet := "zyxwvutsrqponmlkjihgfedcbaZYXWVUTSRQPONMLKJIHGFEDCBA9876543210"
+	g := mustNew(t, Config{Strategy: StrategyCounter, Length: 1, Alphabet: alphabet, NextCounter: counterFrom(0)})
+	for i := 0; i < len(alphabet); i++ {
+		if code := generate(t, g, "", 0); code != alphabet[i:i+1] {
+			t.Fatalf("counter %d = %s, want %c", i, code, alphabet[i])
+		}
+	}
+}
+
+func TestCounterGeneratorError(t *testing.T) {
+	failure := errors.New("sequence unavailable")
+	g := mustNew(t, Config{Strategy: StrategyCounter, NextCounter: func(context.Context) (int64, error) {
+		return 0, failure
+	}})
+	if _, err := g.Generate(context.Background(), "", 0); !errors.Is(err, failure) {
+		t.Errorf("Generate() = %v, want the counter's error", err)
+	}
+}
+
+func TestTimeGenerator(t *testing.T) {
+	g := mustNew(t, Config{Strategy: StrategyTime, Length: 12})
+
+	first := generate(t, g, "", 0)
+	time.Sleep(2 * time.Millisecond)
+	second := generate(t, g, "", 0)
+	for _, code := range []string{first, second} {
+		if len(code) != 12 || !onlyFrom(code, sortedAlphabet) {
+			t.Fatalf("invalid code %q", code)
+		}
+	}
+	if first[:timestampChars] >= second[:timestampChars] {
+		t.Errorf("later code %s doesn't sort after %s", second, first)
+	}
+
+	// codes within a millisecond only differ in the random characters, enough
+	// of them keep a burst of codes apart
+	g = mustNew(t, Config{Strategy: StrategyTime, Length: MaxLength - MaxAttempts + 1})
+	seen := map[string]bool{}
+	for i := 0; i < 10000; i++ {
+		code := generate(t, g, "", 0)
+		if seen[code] {
+			t.Fatalf("code %s came up twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	if !Deterministic(mustNew(t, Config{})) {
+		t.Error("hash codes are not deterministic")
+	}
+	for _, cfg := range []Config{
+		{Strategy: StrategyRandom},
+		{Strategy: StrategyCounter, NextCounter: counterFrom(0)},
+		{Strategy: StrategyTime},
+	} {
+		if Deterministic(mustNew(t, cfg)) {
+			t.Errorf("%s codes are deterministic", cfg.Strategy)
+		}
+	}
+}
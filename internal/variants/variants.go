@@ -0,0 +1,119 @@
+package variants
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	MaxVariants   = 10
+	MaxWeight     = 10000
+	maxNameLength = 32
+)
+
+// Variant is one destination of a split link. Visitors are spread over the
+// variants in proportion to their weights.
+type Variant struct {
+	Name   string `form:"name" json:"name"`
+	Link   string `form:"link" json:"link"`
+	Weight int    `form:"weight" json:"weight"`
+}
+
+// Normalize checks the variants of a link. Unnamed variants are called A, B
+// and so on by their position.
+func Normalize(variants []Variant) ([]Variant, error) {
+	if len(variants) < 2 || len(variants) > MaxVariants {
+		return nil, fmt.Errorf("a split link needs between 2 and %d variants", MaxVariants)
+	}
+
+	seen := make(map[string]struct{}, len(variants))
+	normalized := make([]Variant, 0, len(variants))
+	for i, variant := range variants {
+		name := strings.TrimSpace(variant.Name)
+		if name == "" {
+			name = string(rune('A' + i))
+		}
+		if !validName(name) {
+			return nil, fmt.Errorf("variant name %q must be at most %d letters, digits, - or _", name, maxNameLength)
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("variant %s is listed twice", name)
+		}
+		seen[name] = struct{}{}
+		if variant.Link == "" {
+			return nil, fmt.Errorf("variant %s has no link", name)
+		}
+		if variant.Weight < 1 || variant.Weight > MaxWeight {
+			return nil, fmt.Errorf("variant %s needs a weight between 1 and %d", name, MaxWeight)
+		}
+		normalized = append(normalized, Variant{Name: name, Link: variant.Link, Weight: variant.Weight})
+	}
+	return normalized, nil
+}
+
+// Decode reads variants stored as JSON, no data is no variants
+func Decode(data []byte) ([]Variant, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var variants []Variant
+	if err := json.Unmarshal(data, &variants); err != nil {
+		return nil, fmt.Errorf("invalid variants: %w", err)
+	}
+	return variants, nil
+}
+
+// Find looks a variant up by name
+func Find(variants []Variant, name string) (Variant, bool) {
+	for _, variant := range variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
+
+// Pick chooses a variant by weight for key. The same key always gets the same
+// variant as long as the variants don't change.
+func Pick(variants []Variant, key uint64) Variant {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	if total == 0 {
+		return Variant{}
+	}
+	n := int(key % uint64(total))
+	for _, variant := range variants {
+		if n < variant.Weight {
+			return variant
+		}
+		n -= variant.Weight
+	}
+	return variants[len(variants)-1]
+}
+
+// Key hashes what identifies a visitor into a key for Pick. The parts are kept
+// apart so that moving text from one to the next gives another key.
+func Key(parts ...string) uint64 {
+	h := fnv.New64a()
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+func validName(name string) bool {
+	if len(name) > maxNameLength {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package variants
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	vs, err := Normalize([]Variant{{Link: "https://a.test", Weight: 70}, {Name: " new ", Link: "https://b.test", Weight: 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs[0].Name != "A" || vs[1].Name != "new" {
+		t.Errorf("Normalize names = %q, %q, want A, new", vs[0].Name, vs[1].Name)
+	}
+
+	invalid := map[string][]Variant{
+		"one variant":    {{Link: "https://a.test", Weight: 1}},
+		"duplicate name": {{Name: "x", Link: "https://a.test", Weight: 1}, {Name: "x", Link: "https://b.test", Weight: 1}},
+		"invalid name":   {{Name: "a:b", Link: "https://a.test", Weight: 1}, {Link: "https://b.test", Weight: 1}},
+		"no link":        {{Link: "https://a.test", Weight: 1}, {Weight: 1}},
+		"zero weight":    {{Link: "https://a.test", Weight: 0}, {Link: "https://b.test", Weight: 1}},
+		"huge weight":    {{Link: "https://a.test", Weight: MaxWeight + 1}, {Link: "https://b.test", Weight: 1}},
+	}
+	for name, vs := range invalid {
+		if _, err := Normalize(vs); err == nil {
+			t.Errorf("Normalize accepted %s", name)
+		}
+	}
+
+	tooMany := make([]Variant, MaxVariants+1)
+	for i := range tooMany {
+		tooMany[i] = Variant{Link: "https://a.test", Weight: 1}
+	}
+	if _, err := Normalize(tooMany); err == nil {
+		t.Errorf("Normalize accepted %d variants", len(tooMany))
+	}
+}
+
+func TestPickFollowsWeights(t *testing.T) {
+	vs := []Variant{{Name: "A", Weight: 70}, {Name: "B", Weight: 20}, {Name: "C", Weight: 10}}
+
+	// visitor keys are hashes, so spread them the same way
+	const visitors = 100000
+	counts := map[string]int{}
+	for i := 0; i < visitors; i++ {
+		counts[Pick(vs, Key("link", strconv.Itoa(i))).Name]++
+	}
+	for _, v := range vs {
+		share := float64(counts[v.Name]) / visitors * 100
+		if math.Abs(share-float64(v.Weight)) > 1 {
+			t.Errorf("variant %s got %.1f%% of visitors, want about %d%%", v.Name, share, v.Weight)
+		}
+	}
+}
+
+func TestPickIsSticky(t *testing.T) {
+	vs := []Variant{{Name: "A", Weight: 50}, {Name: "B", Weight: 50}}
+	for i := 0; i < 100; i++ {
+		key := Key("link", "203.0.113.7", "agent "+strconv.Itoa(i))
+		first := Pick(vs, key)
+		for j := 0; j < 5; j++ {
+			if again := Pick(vs, Key("link", "203.0.113.7", "agent "+strconv.Itoa(i))); again.Name != first.Name {
+				t.Fatalf("visitor %d got %s and then %s", i, first.Name, again.Name)
+			}
+		}
+	}
+}
+
+func TestPickCoversAllWeights(t *testing.T) {
+	vs := []Variant{{Name: "A", Weight: 2}, {Name: "B", Weight: 1}}
+	want := []string{"A", "A", "B", "A", "A", "B"}
+	for key, name := range want {
+		if got := Pick(vs, uint64(key)); got.Name != name {
+			t.Errorf("Pick(%d) = %s, want %s", key, got.Name, name)
+		}
+	}
+}
+
+func TestKeyKeepsPartsApart(t *testing.T) {
+	if Key("ab", "c") == Key("a", "bc") {
+		t.Error("Key doesn't tell where parts end")
+	}
+	if Key("a", "b") != Key("a", "b") {
+		t.Error("Key isn't stable")
+	}
+}
+
+func TestFind(t *testing.T) {
+	vs := []Variant{{Name: "A", Link: "https://a.test"}, {Name: "B", Link: "https://b.test"}}
+	if v, ok := Find(vs, "B"); !ok || v.Link != "https://b.test" {
+		t.Errorf("Find(B) = %v, %v", v, ok)
+	}
+	// a cookie for a variant that was removed picks again
+	if _, ok := Find(vs, "C"); ok {
+		t.Error("Find found a missing variant")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	vs, err := Decode([]byte(`[{"name":"A","link":"https://a.test","weight":3}]`))
+	if err != nil || len(vs) != 1 || vs[0].Weight != 3 {
+		t.Errorf("Decode = %v, %v", vs, err)
+	}
+	if vs, err := Decode(nil); vs != nil || err != nil {
+		t.Errorf("Decode(nil) = %v, %v, want nothing", vs, err)
+	}
+	if _, err := Decode([]byte(`{`)); err == nil {
+		t.Error("Decode accepted invalid json")
+	}
+}
@@ -0,0 +1,22 @@
+-- name: RecordAnonymousLink :exec
+INSERT INTO anonymous_links(user_id, hash, session_hash)
+VALUES ($1, $2, $3);
+
+-- name: ClaimAnonymousLinks :many
+-- Codes the claiming user already has on a custom domain stay anonymous.
+WITH claimed AS (
+    DELETE FROM anonymous_links
+    WHERE anonymous_links.user_id = @anonymous_id AND session_hash = @session_hash
+    RETURNING anonymous_links.user_id, anonymous_links.hash
+)
+UPDATE links SET user_id = @user_id
+FROM claimed
+WHERE links.user_id = claimed.user_id AND links.hash = claimed.hash
+  AND links.deleted_at IS NULL
+  AND (links.expires_at IS NULL OR links.expires_at > NOW())
+  AND NOT EXISTS (SELECT 1 FROM links mine WHERE mine.user_id = @user_id AND mine.hash = links.hash)
+RETURNING links.*;
+
+-- name: PurgeExpiredAnonymousLinks :execrows
+DELETE FROM links
+WHERE user_id = @anonymous_id AND expires_at <= NOW();
@@ -0,0 +1,35 @@
+-- name: CreateDomain :one
+INSERT INTO custom_domains(user_id, hostname, verification_token)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetDomain :one
+SELECT * FROM custom_domains
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetUserDomainByHostname :one
+SELECT * FROM custom_domains
+WHERE user_id = $1 AND hostname = $2;
+
+-- name: GetVerifiedDomain :one
+SELECT * FROM custom_domains
+WHERE hostname = $1 AND verified_at IS NOT NULL;
+
+-- name: ListDomains :many
+SELECT * FROM custom_domains
+WHERE user_id = $1
+ORDER BY hostname;
+
+-- name: MarkDomainVerified :one
+UPDATE custom_domains
+SET verified_at = NOW()
+WHERE id = @id AND user_id = @user_id
+RETURNING *;
+
+-- name: CountLiveDomainLinks :one
+SELECT count(*) FROM links
+WHERE domain_id = $1 AND deleted_at IS NULL;
+
+-- name: DeleteDomain :execrows
+DELETE FROM custom_domains
+WHERE id = $1 AND user_id = $2;
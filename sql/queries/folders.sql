@@ -0,0 +1,34 @@
+-- name: CreateFolder :one
+INSERT INTO folders(user_id, name)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: GetFolder :one
+SELECT * FROM folders
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListFolders :many
+SELECT * FROM folders
+WHERE user_id = $1
+ORDER BY name;
+
+-- name: RenameFolder :one
+UPDATE folders
+SET name = @name
+WHERE id = @id AND user_id = @user_id
+RETURNING *;
+
+-- name: DeleteFolder :execrows
+DELETE FROM folders
+WHERE id = $1 AND user_id = $2;
+
+-- name: MoveLinks :execrows
+UPDATE links
+SET folder_id = sqlc.narg('folder_id')
+WHERE user_id = @user_id AND hash = ANY(@hashes::text[]) AND deleted_at IS NULL;
+
+-- name: UpsertFolder :one
+INSERT INTO folders(user_id, name)
+VALUES ($1, $2)
+ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+RETURNING *;
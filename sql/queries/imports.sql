@@ -0,0 +1,34 @@
+-- name: CreateImportJob :one
+INSERT INTO import_jobs(user_id, source, total)
+VALUES ($1, $2, $3)
+RETURNING *;
+
+-- name: GetImportJob :one
+SELECT * FROM import_jobs
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListImportJobs :many
+SELECT * FROM import_jobs
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 50;
+
+-- name: RecordImportProgress :exec
+UPDATE import_jobs
+SET status = 'running',
+    processed = processed + @processed,
+    created = created + @created,
+    conflicts = conflicts + @conflicts,
+    failed = failed + @failed,
+    problems = problems || @problems::jsonb
+WHERE id = @id;
+
+-- name: FinishImportJob :exec
+UPDATE import_jobs
+SET status = @status, error = sqlc.narg('error'), finished_at = NOW()
+WHERE id = @id;
+
+-- name: FailInterruptedImportJobs :execrows
+UPDATE import_jobs
+SET status = 'failed', error = 'interrupted by a restart', finished_at = NOW()
+WHERE status IN ('pending', 'running');
@@ -1,8 +1,87 @@
 -- name: InsertLink :one
-INSERT INTO links(hash, user_id, link)
-VALUES ($1, $2, $3)
+-- a taken code conflicts on the short domain or on the user, either way no row is returned
+INSERT INTO links(hash, user_id, link, expires_at, canonical_link, password_hash, max_visits, title, domain, folder_id,
+                  not_before, not_after, schedule_days, schedule_start, schedule_end, schedule_tz, fallback_url, custom_alias,
+                  domain_id, ios_link, android_link, geo_targets, variants)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23)
+ON CONFLICT DO NOTHING
 RETURNING *;
 
--- name: GetLink :one
+-- name: GetDomainLink :one
 SELECT * FROM links
-WHERE hash = $1 LIMIT 1;
\ No newline at end of file
+WHERE hash = @hash AND domain_id IS NOT DISTINCT FROM sqlc.narg('domain_id')::uuid;
+
+-- name: GetUserLink :one
+SELECT * FROM links
+WHERE hash = $1 AND user_id = $2;
+
+-- name: NextLinkCode :one
+SELECT nextval('link_code_seq')::bigint;
+
+-- name: ConsumeLinkVisit :one
+UPDATE links
+SET visit_count = visit_count + 1
+WHERE hash = @hash AND domain_id IS NOT DISTINCT FROM sqlc.narg('domain_id')::uuid
+  AND deleted_at IS NULL AND (max_visits IS NULL OR visit_count < max_visits)
+RETURNING visit_count;
+
+-- name: UpdateLink :one
+UPDATE links
+SET link = COALESCE(sqlc.narg('link'), link),
+    canonical_link = COALESCE(sqlc.narg('canonical_link'), canonical_link),
+    domain = COALESCE(sqlc.narg('domain'), domain),
+    expires_at = CASE WHEN @set_expires_at::boolean THEN sqlc.narg('expires_at') ELSE expires_at END,
+    not_before = CASE WHEN @set_not_before::boolean THEN sqlc.narg('not_before') ELSE not_before END,
+    not_after = CASE WHEN @set_not_after::boolean THEN sqlc.narg('not_after') ELSE not_after END,
+    schedule_days = CASE WHEN @set_schedule::boolean THEN sqlc.narg('schedule_days') ELSE schedule_days END,
+    schedule_start = CASE WHEN @set_schedule::boolean THEN sqlc.narg('schedule_start') ELSE schedule_start END,
+    schedule_end = CASE WHEN @set_schedule::boolean THEN sqlc.narg('schedule_end') ELSE schedule_end END,
+    schedule_tz = CASE WHEN @set_schedule::boolean THEN sqlc.narg('schedule_tz') ELSE schedule_tz END,
+    fallback_url = CASE WHEN @set_fallback_url::boolean THEN sqlc.narg('fallback_url') ELSE fallback_url END,
+    ios_link = CASE WHEN @set_ios_link::boolean THEN sqlc.narg('ios_link') ELSE ios_link END,
+    android_link = CASE WHEN @set_android_link::boolean THEN sqlc.narg('android_link') ELSE android_link END,
+    geo_targets = CASE WHEN @set_geo_targets::boolean THEN sqlc.narg('geo_targets') ELSE geo_targets END,
+    variants = CASE WHEN @set_variants::boolean THEN sqlc.narg('variants') ELSE variants END,
+    title = COALESCE(sqlc.narg('title'), title)
+WHERE hash = @hash AND user_id = @user_id AND deleted_at IS NULL
+RETURNING *;
+
+-- name: SoftDeleteLink :one
+UPDATE links
+SET deleted_at = NOW()
+WHERE hash = $1 AND user_id = $2 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: RestoreLink :one
+UPDATE links
+SET deleted_at = NULL
+WHERE hash = @hash AND user_id = @user_id AND deleted_at > @deleted_after::timestamptz
+RETURNING *;
+
+-- name: PurgeDeletedLinks :execrows
+DELETE FROM links
+WHERE deleted_at < @deleted_before::timestamptz;
+
+-- name: ListUserLinks :many
+SELECT * FROM links
+WHERE user_id = @user_id
+  AND deleted_at IS NULL
+  AND (sqlc.narg('cursor_created_at')::timestamptz IS NULL
+       OR (created_at, hash) < (sqlc.narg('cursor_created_at')::timestamptz, sqlc.narg('cursor_hash')::text))
+  AND (sqlc.narg('created_after')::timestamptz IS NULL OR created_at >= sqlc.narg('created_after')::timestamptz)
+  AND (sqlc.narg('created_before')::timestamptz IS NULL OR created_at < sqlc.narg('created_before')::timestamptz)
+  AND (sqlc.narg('domain')::text IS NULL OR domain = sqlc.narg('domain')::text OR right(domain, length(sqlc.narg('domain')::text) + 1) = '.' || sqlc.narg('domain')::text)
+  AND (sqlc.narg('status')::text IS NULL
+       OR (sqlc.narg('status')::text = 'active'
+           AND (expires_at IS NULL OR expires_at > NOW())
+           AND (max_visits IS NULL OR visit_count < max_visits))
+       OR (sqlc.narg('status')::text = 'expired'
+           AND (expires_at <= NOW() OR visit_count >= max_visits)))
+  AND (sqlc.narg('folder_id')::uuid IS NULL OR folder_id = sqlc.narg('folder_id')::uuid)
+  AND (sqlc.narg('tag')::text IS NULL OR EXISTS (
+       SELECT 1 FROM link_tags JOIN tags ON tags.id = link_tags.tag_id
+       WHERE link_tags.user_id = links.user_id AND link_tags.link_hash = links.hash AND tags.name = sqlc.narg('tag')::text))
+  AND (sqlc.narg('query')::text IS NULL
+       OR to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(link, '')) @@ websearch_to_tsquery('simple', sqlc.narg('query')::text))
+ORDER BY created_at DESC, hash DESC
+LIMIT @page_size;
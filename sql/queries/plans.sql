@@ -0,0 +1,41 @@
+-- name: LockUser :exec
+SELECT id FROM users
+WHERE id = $1
+FOR UPDATE;
+
+-- name: GetUserPlan :one
+SELECT plans.* FROM users
+JOIN plans ON plans.name = users.plan
+WHERE users.id = $1;
+
+-- name: GetUserQuota :one
+SELECT plans.name AS plan,
+       plans.links_per_month,
+       plans.active_links,
+       plans.custom_aliases,
+       plans.api_calls_per_day,
+       users.total_url_shortened,
+       COALESCE((
+           SELECT links_created FROM monthly_usage
+           WHERE monthly_usage.user_id = users.id
+             AND month = date_trunc('month', NOW() AT TIME ZONE 'UTC')::date
+       ), 0)::int AS monthly_links_used,
+       (
+           SELECT count(*) FROM links
+           WHERE links.user_id = users.id AND deleted_at IS NULL
+             AND (expires_at IS NULL OR expires_at > NOW())
+       )::int AS active_links_used,
+       (
+           SELECT count(*) FROM links
+           WHERE links.user_id = users.id AND custom_alias AND deleted_at IS NULL
+             AND (expires_at IS NULL OR expires_at > NOW())
+       )::int AS custom_aliases_used
+FROM users
+JOIN plans ON plans.name = users.plan
+WHERE users.id = $1;
+
+-- name: AddMonthlyLinks :exec
+INSERT INTO monthly_usage (user_id, month, links_created)
+VALUES (@user_id, date_trunc('month', NOW() AT TIME ZONE 'UTC')::date, @amount::int)
+ON CONFLICT (user_id, month)
+DO UPDATE SET links_created = monthly_usage.links_created + EXCLUDED.links_created;
@@ -0,0 +1,46 @@
+-- name: CreateTag :one
+INSERT INTO tags(user_id, name)
+VALUES ($1, $2)
+RETURNING *;
+
+-- name: ListTags :many
+SELECT * FROM tags
+WHERE user_id = $1
+ORDER BY name;
+
+-- name: RenameTag :one
+UPDATE tags
+SET name = @name
+WHERE id = @id AND user_id = @user_id
+RETURNING *;
+
+-- name: DeleteTag :execrows
+DELETE FROM tags
+WHERE id = $1 AND user_id = $2;
+
+-- name: UpsertTags :many
+INSERT INTO tags(user_id, name)
+SELECT @user_id::uuid, unnest(@names::text[])
+ON CONFLICT (user_id, name) DO UPDATE SET name = EXCLUDED.name
+RETURNING *;
+
+-- name: TagLinks :execrows
+INSERT INTO link_tags(user_id, link_hash, tag_id)
+SELECT links.user_id, links.hash, tags.id
+FROM links CROSS JOIN tags
+WHERE links.user_id = @user_id AND links.hash = ANY(@hashes::text[]) AND links.deleted_at IS NULL
+  AND tags.user_id = @user_id AND tags.id = ANY(@tag_ids::uuid[])
+ON CONFLICT DO NOTHING;
+
+-- name: UntagLinks :execrows
+DELETE FROM link_tags
+USING links, tags
+WHERE link_tags.user_id = links.user_id AND link_tags.link_hash = links.hash AND link_tags.tag_id = tags.id
+  AND links.user_id = @user_id AND links.hash = ANY(@hashes::text[])
+  AND tags.name = ANY(@names::text[]);
+
+-- name: ListLinkTags :many
+SELECT link_tags.link_hash, tags.name
+FROM link_tags JOIN tags ON tags.id = link_tags.tag_id
+WHERE link_tags.user_id = @user_id AND link_tags.link_hash = ANY(@hashes::text[])
+ORDER BY tags.name;
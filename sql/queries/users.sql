@@ -16,3 +16,9 @@ UPDATE users
 SET total_url_shortened = total_url_shortened + 1
 WHERE id = $1
 RETURNING *;
+
+-- name: AddUserURLCounter :one
+UPDATE users
+SET total_url_shortened = total_url_shortened + @amount::int
+WHERE id = @id
+RETURNING *;
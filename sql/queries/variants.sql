@@ -0,0 +1,10 @@
+-- name: AddVariantServed :exec
+INSERT INTO link_variant_stats (user_id, hash, variant, served)
+SELECT links.user_id, links.hash, @variant::text, @served::bigint FROM links
+WHERE links.hash = @hash AND links.domain_id IS NOT DISTINCT FROM sqlc.narg('domain_id')::uuid
+ON CONFLICT (user_id, hash, variant)
+DO UPDATE SET served = link_variant_stats.served + EXCLUDED.served;
+
+-- name: ListVariantStats :many
+SELECT variant, served FROM link_variant_stats
+WHERE user_id = $1 AND hash = $2;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN expires_at TIMESTAMPTZ;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN expires_at;
@@ -0,0 +1,5 @@
+-- +goose Up
+CREATE SEQUENCE link_code_seq;
+
+-- +goose Down
+DROP SEQUENCE link_code_seq;
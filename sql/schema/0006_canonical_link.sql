@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN canonical_link TEXT;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN canonical_link;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN max_visits INT CHECK (max_visits > 0);
+ALTER TABLE links ADD COLUMN visit_count INT NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN visit_count;
+ALTER TABLE links DROP COLUMN max_visits;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN title TEXT;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN title;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN deleted_at TIMESTAMPTZ;
+CREATE INDEX links_deleted_at_idx ON links (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX links_deleted_at_idx;
+ALTER TABLE links DROP COLUMN deleted_at;
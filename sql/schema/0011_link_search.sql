@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE links ADD COLUMN domain TEXT;
+UPDATE links
+SET domain = lower(substring(coalesce(canonical_link, link) from '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^/?#@]*@)?([^/?#:]+)'));
+
+CREATE INDEX links_user_created_idx ON links (user_id, created_at DESC, hash DESC);
+CREATE INDEX links_user_domain_idx ON links (user_id, domain);
+CREATE INDEX links_search_idx ON links
+    USING GIN (to_tsvector('simple', coalesce(title, '') || ' ' || coalesce(link, '')));
+
+-- +goose Down
+DROP INDEX links_search_idx;
+DROP INDEX links_user_domain_idx;
+DROP INDEX links_user_created_idx;
+ALTER TABLE links DROP COLUMN domain;
@@ -0,0 +1,32 @@
+-- +goose Up
+CREATE TABLE folders (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE link_tags (
+    link_hash VARCHAR(20) NOT NULL REFERENCES links(hash) ON DELETE CASCADE,
+    tag_id UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (link_hash, tag_id)
+);
+CREATE INDEX link_tags_tag_id_idx ON link_tags (tag_id);
+
+ALTER TABLE links ADD COLUMN folder_id UUID REFERENCES folders(id) ON DELETE SET NULL;
+CREATE INDEX links_folder_id_idx ON links (folder_id);
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN folder_id;
+DROP TABLE link_tags;
+DROP TABLE tags;
+DROP TABLE folders;
@@ -0,0 +1,28 @@
+-- +goose Up
+ALTER TABLE links
+    ADD COLUMN not_before TIMESTAMPTZ,
+    ADD COLUMN not_after TIMESTAMPTZ,
+    -- bit n is set when the link opens on weekday n, sunday being 0
+    ADD COLUMN schedule_days SMALLINT CHECK (schedule_days BETWEEN 1 AND 127),
+    ADD COLUMN schedule_start TIME,
+    ADD COLUMN schedule_end TIME,
+    ADD COLUMN schedule_tz TEXT,
+    ADD COLUMN fallback_url TEXT,
+    ADD CONSTRAINT links_window_check CHECK (not_before < not_after),
+    ADD CONSTRAINT links_schedule_check CHECK (
+        (schedule_days IS NULL) = (schedule_start IS NULL)
+        AND (schedule_start IS NULL) = (schedule_end IS NULL)
+        AND (schedule_end IS NULL) = (schedule_tz IS NULL)
+    );
+
+-- +goose Down
+ALTER TABLE links
+    DROP CONSTRAINT links_schedule_check,
+    DROP CONSTRAINT links_window_check,
+    DROP COLUMN fallback_url,
+    DROP COLUMN schedule_tz,
+    DROP COLUMN schedule_end,
+    DROP COLUMN schedule_start,
+    DROP COLUMN schedule_days,
+    DROP COLUMN not_after,
+    DROP COLUMN not_before;
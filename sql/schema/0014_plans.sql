@@ -0,0 +1,33 @@
+-- +goose Up
+-- NULL limits are unlimited
+CREATE TABLE plans (
+    name TEXT PRIMARY KEY,
+    links_per_month INT CHECK (links_per_month >= 0),
+    active_links INT CHECK (active_links >= 0),
+    custom_aliases INT CHECK (custom_aliases >= 0),
+    api_calls_per_day INT CHECK (api_calls_per_day >= 0)
+);
+
+INSERT INTO plans (name, links_per_month, active_links, custom_aliases, api_calls_per_day) VALUES
+    ('free', 50, 200, 5, 1000),
+    ('pro', 5000, 50000, 1000, 100000),
+    ('enterprise', NULL, NULL, NULL, NULL);
+
+ALTER TABLE users ADD COLUMN plan TEXT NOT NULL DEFAULT 'free' REFERENCES plans(name);
+
+ALTER TABLE links ADD COLUMN custom_alias BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX links_user_custom_alias_idx ON links (user_id) WHERE custom_alias;
+
+CREATE TABLE monthly_usage (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    month DATE NOT NULL,
+    links_created INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, month)
+);
+
+-- +goose Down
+DROP TABLE monthly_usage;
+DROP INDEX links_user_custom_alias_idx;
+ALTER TABLE links DROP COLUMN custom_alias;
+ALTER TABLE users DROP COLUMN plan;
+DROP TABLE plans;
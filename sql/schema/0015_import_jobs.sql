@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE import_jobs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    total INT NOT NULL,
+    processed INT NOT NULL DEFAULT 0,
+    created INT NOT NULL DEFAULT 0,
+    conflicts INT NOT NULL DEFAULT 0,
+    failed INT NOT NULL DEFAULT 0,
+    -- rows that failed or didn't keep their code
+    problems JSONB NOT NULL DEFAULT '[]',
+    error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+CREATE INDEX import_jobs_user_idx ON import_jobs (user_id, created_at DESC);
+
+-- +goose Down
+DROP TABLE import_jobs;
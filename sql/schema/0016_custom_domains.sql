@@ -0,0 +1,48 @@
+-- +goose Up
+CREATE TABLE custom_domains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hostname TEXT NOT NULL,
+    verification_token TEXT NOT NULL,
+    verified_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (user_id, hostname)
+);
+-- anyone may add a hostname, only one account can prove that it owns it
+CREATE UNIQUE INDEX custom_domains_verified_hostname_idx ON custom_domains (hostname) WHERE verified_at IS NOT NULL;
+
+-- NULL is the default short domain
+ALTER TABLE links ADD COLUMN domain_id UUID REFERENCES custom_domains(id) ON DELETE CASCADE;
+
+-- codes are unique per short domain, and per user so that owners can keep
+-- addressing their links by code
+ALTER TABLE link_tags DROP CONSTRAINT link_tags_link_hash_fkey;
+ALTER TABLE links DROP CONSTRAINT links_pkey;
+ALTER TABLE links ADD PRIMARY KEY (user_id, hash);
+CREATE UNIQUE INDEX links_default_domain_hash_idx ON links (hash) WHERE domain_id IS NULL;
+CREATE UNIQUE INDEX links_custom_domain_hash_idx ON links (domain_id, hash) WHERE domain_id IS NOT NULL;
+CREATE INDEX links_hash_idx ON links (hash);
+
+ALTER TABLE link_tags ADD COLUMN user_id UUID;
+UPDATE link_tags SET user_id = links.user_id FROM links WHERE links.hash = link_tags.link_hash;
+ALTER TABLE link_tags ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE link_tags DROP CONSTRAINT link_tags_pkey;
+ALTER TABLE link_tags ADD PRIMARY KEY (user_id, link_hash, tag_id);
+ALTER TABLE link_tags ADD CONSTRAINT link_tags_link_fkey
+    FOREIGN KEY (user_id, link_hash) REFERENCES links(user_id, hash) ON DELETE CASCADE;
+
+-- +goose Down
+DELETE FROM links WHERE domain_id IS NOT NULL;
+ALTER TABLE link_tags DROP CONSTRAINT link_tags_link_fkey;
+ALTER TABLE link_tags DROP CONSTRAINT link_tags_pkey;
+ALTER TABLE link_tags ADD PRIMARY KEY (link_hash, tag_id);
+ALTER TABLE link_tags DROP COLUMN user_id;
+DROP INDEX links_hash_idx;
+DROP INDEX links_custom_domain_hash_idx;
+DROP INDEX links_default_domain_hash_idx;
+ALTER TABLE links DROP CONSTRAINT links_pkey;
+ALTER TABLE links ADD PRIMARY KEY (hash);
+ALTER TABLE link_tags ADD CONSTRAINT link_tags_link_hash_fkey
+    FOREIGN KEY (link_hash) REFERENCES links(hash) ON DELETE CASCADE;
+ALTER TABLE links DROP COLUMN domain_id;
+DROP TABLE custom_domains;
@@ -0,0 +1,26 @@
+-- +goose Up
+-- links shortened without an account belong to the anonymous user until the
+-- browser session that created them claims them after signing up
+INSERT INTO plans (name, links_per_month, active_links, custom_aliases, api_calls_per_day)
+VALUES ('anonymous', NULL, NULL, 0, NULL);
+
+-- the password hash is no bcrypt hash, nobody can log in as this user
+INSERT INTO users (id, email, password_hash, plan)
+VALUES ('00000000-0000-0000-0000-000000000000', 'anonymous@shortener.invalid', '!', 'anonymous');
+
+CREATE TABLE anonymous_links (
+    user_id UUID NOT NULL,
+    hash VARCHAR(20) NOT NULL,
+    -- sha256 of the session cookie, so the table can't be used to claim links
+    session_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, hash),
+    FOREIGN KEY (user_id, hash) REFERENCES links(user_id, hash) ON DELETE CASCADE
+);
+
+CREATE INDEX anonymous_links_session_idx ON anonymous_links (session_hash);
+
+-- +goose Down
+DROP TABLE anonymous_links;
+DELETE FROM users WHERE id = '00000000-0000-0000-0000-000000000000';
+DELETE FROM plans WHERE name = 'anonymous';
@@ -0,0 +1,10 @@
+-- +goose Up
+-- visitors on iOS and Android go to these instead of the link when they are set
+ALTER TABLE links
+    ADD COLUMN ios_link TEXT,
+    ADD COLUMN android_link TEXT;
+
+-- +goose Down
+ALTER TABLE links
+    DROP COLUMN android_link,
+    DROP COLUMN ios_link;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- country rules as [{"countries": ["DE", "AT"], "link": "..."}], the first
+-- rule with the visitor's country wins and the link is the default
+ALTER TABLE links ADD COLUMN geo_targets JSONB;
+
+-- +goose Down
+ALTER TABLE links DROP COLUMN geo_targets;
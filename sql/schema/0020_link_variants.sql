@@ -0,0 +1,19 @@
+-- +goose Up
+-- split destinations as [{"name": "A", "link": "...", "weight": 70}], they
+-- replace the link for visitors no device or country rule sends elsewhere
+ALTER TABLE links ADD COLUMN variants JSONB;
+
+-- how often each variant was served, claiming an anonymous link takes its
+-- counts along
+CREATE TABLE link_variant_stats (
+    user_id UUID NOT NULL,
+    hash VARCHAR(20) NOT NULL,
+    variant TEXT NOT NULL,
+    served BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, hash, variant),
+    FOREIGN KEY (user_id, hash) REFERENCES links(user_id, hash) ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+-- +goose Down
+DROP TABLE link_variant_stats;
+ALTER TABLE links DROP COLUMN variants;